@@ -0,0 +1,199 @@
+package ainvoke
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// AdapterOptions are the settings shared by the agent CLIs.
+type AdapterOptions struct {
+	// Model selects the model; empty keeps the CLI's default.
+	Model string
+	// ExtraArgs are passed to the CLI after its name. Flags the adapter would
+	// add, such as --model, are not added again when they are present.
+	ExtraArgs []string
+}
+
+// Adapter knows how to run one agent CLI, such as codex or claude.
+type Adapter interface {
+	// Name is the name the adapter is registered under, e.g. "codex".
+	Name() string
+	// Config returns the command, TTY mode and prompt delivery the CLI needs
+	// for opts. The other fields are left for the caller to fill in.
+	Config(opts AdapterOptions) AgentConfig
+}
+
+// Built-in adapters, registered under their names.
+var (
+	// CodexAdapter runs "codex exec" in a workspace-write sandbox unless
+	// another subcommand or --sandbox is given.
+	CodexAdapter Adapter = cliAdapter{name: "codex", args: codexArgs}
+	// ClaudeAdapter runs "claude -p" with the prompt as an argument.
+	ClaudeAdapter Adapter = cliAdapter{name: "claude", delivery: PromptArg, args: claudeArgs}
+	// GeminiAdapter runs gemini with plain text output.
+	GeminiAdapter Adapter = cliAdapter{name: "gemini", args: geminiArgs}
+	// OpenCodeAdapter runs "opencode run" with the prompt as an argument
+	// unless another subcommand is given.
+	OpenCodeAdapter Adapter = cliAdapter{name: "opencode", delivery: PromptArg, args: openCodeArgs}
+)
+
+var adapters = struct {
+	sync.RWMutex
+	byName map[string]Adapter
+}{byName: map[string]Adapter{}}
+
+func init() {
+	for _, a := range []Adapter{CodexAdapter, ClaudeAdapter, GeminiAdapter, OpenCodeAdapter} {
+		RegisterAdapter(a)
+	}
+}
+
+// RegisterAdapter makes a available to LookupAdapter under a.Name(),
+// replacing any adapter registered under the same name.
+func RegisterAdapter(a Adapter) {
+	adapters.Lock()
+	defer adapters.Unlock()
+
+	adapters.byName[a.Name()] = a
+}
+
+// LookupAdapter returns the adapter registered under name. It fails with
+// ErrUnknownAdapter when there is none.
+func LookupAdapter(name string) (Adapter, error) {
+	adapters.RLock()
+	defer adapters.RUnlock()
+
+	a, ok := adapters.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAdapter, name)
+	}
+
+	return a, nil
+}
+
+// Adapters returns the names of the registered adapters in sorted order.
+func Adapters() []string {
+	adapters.RLock()
+	defer adapters.RUnlock()
+
+	names := make([]string, 0, len(adapters.byName))
+	for name := range adapters.byName {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// cliAdapter runs the command called name with the flags added by args.
+type cliAdapter struct {
+	name     string
+	delivery PromptDelivery
+	args     func(argv []string, model string) []string
+}
+
+func (a cliAdapter) Name() string { return a.name }
+
+func (a cliAdapter) Config(opts AdapterOptions) AgentConfig {
+	argv := append([]string{a.name}, opts.ExtraArgs...)
+
+	return AgentConfig{
+		Cmd:            a.args(argv, opts.Model),
+		PromptDelivery: a.delivery,
+	}
+}
+
+func codexArgs(argv []string, model string) []string {
+	out := make([]string, 0, len(argv))
+	out = append(out, argv...)
+
+	if len(out) > 0 && out[0] == "codex" {
+		if len(out) == 1 || !isCodexSubcommand(out[1]) {
+			out = append(out[:1], append([]string{"exec"}, out[1:]...)...)
+		}
+	}
+
+	out = appendModel(out, model)
+
+	if !hasFlag(out, "--sandbox") {
+		out = append(out, "--sandbox", "workspace-write")
+	}
+
+	return out
+}
+
+func openCodeArgs(argv []string, model string) []string {
+	out := make([]string, 0, len(argv))
+	out = append(out, argv...)
+
+	if len(out) > 0 && out[0] == "opencode" {
+		if len(out) == 1 || out[1] == "" || strings.HasPrefix(out[1], "-") || !isOpenCodeSubcommand(out[1]) {
+			out = append(out[:1], append([]string{"run"}, out[1:]...)...)
+		}
+	}
+
+	return appendModel(out, model)
+}
+
+func geminiArgs(argv []string, model string) []string {
+	out := make([]string, 0, len(argv))
+	out = append(out, argv...)
+	out = appendModel(out, model)
+
+	if !hasFlag(out, "--output-format") {
+		out = append(out, "--output-format", "text")
+	}
+
+	return out
+}
+
+func claudeArgs(argv []string, model string) []string {
+	out := make([]string, 0, len(argv))
+	out = append(out, argv...)
+
+	if !hasFlag(out, "-p") && !hasFlag(out, "--print") {
+		out = append(out, "-p")
+	}
+
+	return appendModel(out, model)
+}
+
+// appendModel adds --model unless model is empty or argv already selects one.
+func appendModel(argv []string, model string) []string {
+	if model != "" && !hasFlag(argv, "--model") && !hasFlag(argv, "-m") {
+		argv = append(argv, "--model", model)
+	}
+
+	return argv
+}
+
+func hasFlag(argv []string, name string) bool {
+	return slices.Contains(argv, name)
+}
+
+func isCodexSubcommand(arg string) bool {
+	if arg == "" || strings.HasPrefix(arg, "-") {
+		return false
+	}
+
+	switch arg {
+	case "exec", "review", "login", "logout", "mcp", "mcp-server", "app-server",
+		"completion", "sandbox", "apply", "resume", "fork", "cloud", "features", "help":
+		return true
+	default:
+		return false
+	}
+}
+
+func isOpenCodeSubcommand(arg string) bool {
+	switch arg {
+	case "agent", "attach", "auth", "github", "mcp", "models", "run", "serve",
+		"session", "stats", "export", "import", "web", "acp", "uninstall", "upgrade", "help":
+		return true
+	default:
+		return false
+	}
+}
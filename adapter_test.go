@@ -1,11 +1,13 @@
-package main
+package ainvoke
 
 import (
+	"errors"
 	"reflect"
+	"slices"
 	"testing"
 )
 
-func TestAppendCodexFlags(t *testing.T) {
+func TestCodexArgs(t *testing.T) {
 	tests := []struct {
 		name     string
 		argv     []string
@@ -46,15 +48,15 @@ func TestAppendCodexFlags(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := appendCodexFlags(tt.argv, tt.model)
+			got := codexArgs(tt.argv, tt.model)
 			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("appendCodexFlags() = %v, want %v", got, tt.expected)
+				t.Errorf("codexArgs() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
 }
 
-func TestAppendOpenCodeFlags(t *testing.T) {
+func TestOpenCodeArgs(t *testing.T) {
 	tests := []struct {
 		name     string
 		argv     []string
@@ -89,15 +91,15 @@ func TestAppendOpenCodeFlags(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := appendOpenCodeFlags(tt.argv, tt.model)
+			got := openCodeArgs(tt.argv, tt.model)
 			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("appendOpenCodeFlags() = %v, want %v", got, tt.expected)
+				t.Errorf("openCodeArgs() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
 }
 
-func TestAppendGeminiFlags(t *testing.T) {
+func TestGeminiArgs(t *testing.T) {
 	tests := []struct {
 		name     string
 		argv     []string
@@ -126,15 +128,15 @@ func TestAppendGeminiFlags(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := appendGeminiFlags(tt.argv, tt.model)
+			got := geminiArgs(tt.argv, tt.model)
 			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("appendGeminiFlags() = %v, want %v", got, tt.expected)
+				t.Errorf("geminiArgs() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
 }
 
-func TestAppendClaudeFlags(t *testing.T) {
+func TestClaudeArgs(t *testing.T) {
 	tests := []struct {
 		name     string
 		argv     []string
@@ -145,21 +147,27 @@ func TestAppendClaudeFlags(t *testing.T) {
 			name:     "minimal",
 			argv:     []string{"claude"},
 			model:    "",
-			expected: []string{"claude"},
+			expected: []string{"claude", "-p"},
 		},
 		{
 			name:     "with model",
 			argv:     []string{"claude"},
 			model:    "sonnet",
-			expected: []string{"claude", "--model", "sonnet"},
+			expected: []string{"claude", "-p", "--model", "sonnet"},
+		},
+		{
+			name:     "print flag present",
+			argv:     []string{"claude", "--print"},
+			model:    "",
+			expected: []string{"claude", "--print"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := appendClaudeFlags(tt.argv, tt.model)
+			got := claudeArgs(tt.argv, tt.model)
 			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("appendClaudeFlags() = %v, want %v", got, tt.expected)
+				t.Errorf("claudeArgs() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
@@ -196,3 +204,46 @@ func TestSubcommandChecks(t *testing.T) {
 		}
 	})
 }
+
+func TestAdapters(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     AdapterOptions
+		want     []string
+		delivery PromptDelivery
+	}{
+		{
+			name:     "codex",
+			opts:     AdapterOptions{Model: "gpt-5", ExtraArgs: []string{"--full-auto"}},
+			want:     []string{"codex", "exec", "--full-auto", "--model", "gpt-5", "--sandbox", "workspace-write"},
+			delivery: "",
+		},
+		{name: "claude", want: []string{"claude", "-p"}, delivery: PromptArg},
+		{name: "gemini", want: []string{"gemini", "--output-format", "text"}, delivery: ""},
+		{name: "opencode", opts: AdapterOptions{Model: "m"}, want: []string{"opencode", "run", "--model", "m"}, delivery: PromptArg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := LookupAdapter(tt.name)
+			if err != nil {
+				t.Fatalf("lookup: %v", err)
+			}
+
+			cfg := adapter.Config(tt.opts)
+			if !slices.Equal(cfg.Cmd, tt.want) || cfg.PromptDelivery != tt.delivery || cfg.UseTTY {
+				t.Errorf("unexpected config %+v", cfg)
+			}
+		})
+	}
+
+	if _, err := LookupAdapter("aider"); !errors.Is(err, ErrUnknownAdapter) {
+		t.Fatalf("expected ErrUnknownAdapter, got %v", err)
+	}
+
+	RegisterAdapter(cliAdapter{name: "test-agent", args: func(argv []string, _ string) []string { return argv }})
+
+	if !slices.Contains(Adapters(), "test-agent") || !slices.IsSorted(Adapters()) {
+		t.Fatalf("expected sorted names including test-agent, got %v", Adapters())
+	}
+}
@@ -3,6 +3,7 @@ package adk
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"iter"
 	"os"
@@ -24,7 +25,9 @@ const (
 type ExecAgent struct {
 	agent.Agent
 
-	opts ExecAgentOptions
+	opts           ExecAgentOptions
+	runner         *ainvoke.ExecRunner
+	promptTemplate *ainvoke.PromptTemplate
 }
 
 // NewExecAgent creates a new ExecAgent instance using functional options.
@@ -39,8 +42,43 @@ func NewExecAgent(
 		return nil, fmt.Errorf("invalid options: %w", err)
 	}
 
+	if opts.runDirPolicy.Cleanup == ainvoke.CleanupKeepLast && opts.runDir == "" {
+		return nil, errors.New("invalid options: keep-last run dir cleanup requires a run dir")
+	}
+
 	a := &ExecAgent{opts: opts}
 
+	if opts.promptTemplate != "" {
+		tmpl, err := ainvoke.NewPromptTemplate(opts.promptTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options: %w", err)
+		}
+
+		a.promptTemplate = tmpl
+	}
+
+	agentCmd := append([]string(nil), a.opts.cmd...)
+	agentCmd = append(agentCmd, a.opts.extraArgs...)
+
+	runner, err := ainvoke.NewRunner(ainvoke.AgentConfig{
+		Cmd:            agentCmd,
+		UseTTY:         a.opts.useTTY,
+		PromptDelivery: a.opts.promptDelivery,
+		InlineInput:    a.opts.inlineInput,
+		OutputSource:   a.opts.outputSource,
+		Env:            a.opts.env,
+		EnvAllow:       a.opts.envAllow,
+		EnvDeny:        a.opts.envDeny,
+		CleanEnv:       a.opts.cleanEnv,
+		InputSchema:    a.opts.inputSchema,
+		OutputSchema:   a.opts.outputSchema,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create runner: %w", err)
+	}
+
+	a.runner = runner
+
 	ag, err := agent.New(agent.Config{
 		Name:        a.opts.name,
 		Description: a.opts.description,
@@ -55,6 +93,27 @@ func NewExecAgent(
 	return a, nil
 }
 
+// NewAdapterAgent creates an ExecAgent running the agent CLI of adapter, such
+// as ainvoke.CodexAdapter, with the command, TTY mode and prompt delivery it
+// builds from adapterOpts. Setters may still override the TTY mode and the
+// prompt delivery.
+func NewAdapterAgent(
+	name string,
+	description string,
+	adapter ainvoke.Adapter,
+	adapterOpts ainvoke.AdapterOptions,
+	setters ...OptExecAgentOptionsSetter,
+) (*ExecAgent, error) {
+	cfg := adapter.Config(adapterOpts)
+
+	defaults := []OptExecAgentOptionsSetter{
+		WithExecAgentUseTTY(cfg.UseTTY),
+		WithExecAgentPromptDelivery(cfg.PromptDelivery),
+	}
+
+	return NewExecAgent(name, description, cfg.Cmd, append(defaults, setters...)...)
+}
+
 // Run implements the agent.Agent interface.
 // It processes the input from the invocation context and generates a response by executing a command.
 func (a *ExecAgent) Run(ctx agent.InvocationContext) iter.Seq2[*session.Event, error] {
@@ -72,27 +131,11 @@ func (a *ExecAgent) Run(ctx agent.InvocationContext) iter.Seq2[*session.Event, e
 
 		inv := ainvoke.Invocation{
 			RunDir:       runDir,
+			WorkDir:      a.opts.workDir,
 			SystemPrompt: a.opts.prompt,
-			InputSchema:  a.opts.inputSchema,
-			OutputSchema: a.opts.outputSchema,
 			Input:        a.prepareInput(userInput),
 		}
 
-		agentCmd := append([]string(nil), a.opts.cmd...)
-		if len(a.opts.extraArgs) > 0 {
-			agentCmd = append(agentCmd, a.opts.extraArgs...)
-		}
-
-		runner, err := ainvoke.NewRunner(ainvoke.AgentConfig{
-			Cmd:    agentCmd,
-			UseTTY: a.opts.useTTY,
-		})
-		if err != nil {
-			yield(nil, fmt.Errorf("create runner: %w", err))
-
-			return
-		}
-
 		runCtx := context.Context(ctx)
 
 		if a.opts.timeout > 0 {
@@ -102,7 +145,7 @@ func (a *ExecAgent) Run(ctx agent.InvocationContext) iter.Seq2[*session.Event, e
 			defer cancel()
 		}
 
-		responseText, err := a.execute(runCtx, runner, inv)
+		responseText, err := a.execute(runCtx, a.runner, inv)
 		if err != nil {
 			yield(nil, err)
 
@@ -150,22 +193,47 @@ func (a *ExecAgent) execute(
 		runOpts = append(runOpts, ainvoke.WithStderr(a.opts.stderr))
 	}
 
-	outBytes, errBytes, _, err := runner.Run(ctx, inv, runOpts...)
-	if err != nil {
-		if len(errBytes) == 0 && len(outBytes) > 0 {
-			errBytes = outBytes
-		}
+	runOpts = append(
+		runOpts,
+		ainvoke.WithGracePeriod(a.opts.gracePeriod),
+		ainvoke.WithIdleTimeout(a.opts.idleTimeout),
+		ainvoke.WithEarlyCompletion(a.opts.earlyExit),
+		ainvoke.WithResourceLimits(a.opts.limits),
+		ainvoke.WithPromptTemplate(a.promptTemplate),
+		ainvoke.WithPromptVars(a.opts.promptVars),
+		ainvoke.WithNormalizers(a.opts.normalizers...),
+		ainvoke.WithStrictSchema(a.opts.strictSchema),
+		ainvoke.WithValidators(a.opts.validators...),
+		ainvoke.WithSelfCheck(a.opts.selfCheck),
+	)
+
+	if a.opts.sandbox != nil {
+		runOpts = append(runOpts, ainvoke.WithSandbox(*a.opts.sandbox))
+	}
+
+	if a.opts.check != nil {
+		runOpts = append(runOpts, ainvoke.WithAcceptanceCheck(*a.opts.check))
+	}
 
-		if len(errBytes) > 0 {
+	if a.managedRunDir() {
+		runOpts = append(runOpts, ainvoke.WithManagedRunDir(a.opts.runDirPolicy))
+	}
+
+	res, err := ainvoke.Execute(ctx, runner, inv, runOpts...)
+	if err != nil {
+		if errBytes := res.Diagnostics(); len(errBytes) > 0 {
 			return "", fmt.Errorf("run failed: %w (output: %s)", err, string(errBytes))
 		}
 
 		return "", fmt.Errorf("run failed: %w", err)
 	}
 
-	outputData, err := os.ReadFile(filepath.Join(inv.RunDir, ainvoke.OutputFileName))
-	if err != nil {
-		return "", fmt.Errorf("read output: %w", err)
+	outputData := res.Output
+	if outputData == nil {
+		outputData, err = os.ReadFile(filepath.Join(inv.RunDir, ainvoke.OutputFileName))
+		if err != nil {
+			return "", fmt.Errorf("read output: %w", err)
+		}
 	}
 
 	return a.formatResponse(outputData), nil
@@ -194,10 +262,22 @@ func (a *ExecAgent) formatResponse(outputData []byte) string {
 	return out
 }
 
+func (a *ExecAgent) managedRunDir() bool {
+	return a.opts.runDirPolicy.Cleanup != 0
+}
+
 // prepareRunDir validates that the run directory exists.
+// With a run dir policy the runner creates a fresh directory under runDir
+// (or the system temporary directory, except for keep-last cleanup) and
+// applies the policy itself.
 // Returns the run directory path, a cleanup function, and any error.
 func (a *ExecAgent) prepareRunDir() (string, func(), error) {
 	runDir := a.opts.runDir
+
+	if a.managedRunDir() {
+		return runDir, func() {}, nil
+	}
+
 	if runDir == "" {
 		// Use current working directory as default
 		runDir = "."
@@ -3,27 +3,51 @@ package adk
 import (
 	"io"
 	"time"
+
+	"github.com/metalagman/ainvoke"
 )
 
 //go:generate go tool options-gen -from-struct=ExecAgentOptions -out-filename=execagent_options_generated.go -out-prefix=ExecAgent -defaults-from=func
 type ExecAgentOptions struct {
-	name         string `option:"mandatory" validate:"required"`
-	description  string `option:"mandatory" validate:"required"`
-	prompt       string
-	cmd          []string `option:"mandatory"     validate:"required,dive,required"`
-	extraArgs    []string `option:"variadic=true"`
-	useTTY       bool
-	timeout      time.Duration
-	inputSchema  string
-	outputSchema string
-	runDir       string
-	stdout       io.Writer
-	stderr       io.Writer
+	name           string `option:"mandatory" validate:"required"`
+	description    string `option:"mandatory" validate:"required"`
+	prompt         string
+	promptTemplate string
+	promptVars     map[string]any
+	cmd            []string `option:"mandatory"     validate:"required,dive,required"`
+	extraArgs      []string `option:"variadic=true"`
+	useTTY         bool
+	promptDelivery ainvoke.PromptDelivery
+	inlineInput    bool
+	outputSource   ainvoke.OutputSource
+	timeout        time.Duration
+	gracePeriod    time.Duration
+	idleTimeout    time.Duration
+	earlyExit      bool
+	normalizers    []ainvoke.Normalizer `option:"variadic=true"`
+	limits         ainvoke.ResourceLimits
+	sandbox        *ainvoke.Sandbox
+	env            map[string]string
+	envAllow       []string `option:"variadic=true"`
+	envDeny        []string `option:"variadic=true"`
+	cleanEnv       bool
+	strictSchema   bool
+	validators     []ainvoke.Validator `option:"variadic=true"`
+	check          *ainvoke.AcceptanceCheck
+	selfCheck      string
+	inputSchema    string
+	outputSchema   string
+	runDir         string
+	workDir        string
+	runDirPolicy   ainvoke.RunDirPolicy
+	stdout         io.Writer
+	stderr         io.Writer
 }
 
 func getDefaultExecAgentOptions() ExecAgentOptions {
 	return ExecAgentOptions{
 		useTTY:       false,
+		gracePeriod:  ainvoke.DefaultGracePeriod,
 		inputSchema:  `{"type":"object","properties":{"input":{"type":"string"}},"required":["input"]}`,
 		outputSchema: `{"type":"object","properties":{"output":{"type":"string"}},"required":["output"]}`,
 	}
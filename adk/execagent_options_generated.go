@@ -9,6 +9,7 @@ import (
 
 	errors461e464ebed9 "github.com/kazhuravlev/options-gen/pkg/errors"
 	validator461e464ebed9 "github.com/kazhuravlev/options-gen/pkg/validator"
+	"github.com/metalagman/ainvoke"
 )
 
 type OptExecAgentOptionsSetter func(o *ExecAgentOptions)
@@ -26,13 +27,34 @@ func NewExecAgentOptions(
 	o.name = defaultOpts.name
 	o.description = defaultOpts.description
 	o.prompt = defaultOpts.prompt
+	o.promptTemplate = defaultOpts.promptTemplate
+	o.promptVars = defaultOpts.promptVars
 	o.cmd = defaultOpts.cmd
 	o.extraArgs = defaultOpts.extraArgs
 	o.useTTY = defaultOpts.useTTY
+	o.promptDelivery = defaultOpts.promptDelivery
+	o.inlineInput = defaultOpts.inlineInput
+	o.outputSource = defaultOpts.outputSource
 	o.timeout = defaultOpts.timeout
+	o.gracePeriod = defaultOpts.gracePeriod
+	o.idleTimeout = defaultOpts.idleTimeout
+	o.earlyExit = defaultOpts.earlyExit
+	o.normalizers = defaultOpts.normalizers
+	o.limits = defaultOpts.limits
+	o.sandbox = defaultOpts.sandbox
+	o.env = defaultOpts.env
+	o.envAllow = defaultOpts.envAllow
+	o.envDeny = defaultOpts.envDeny
+	o.cleanEnv = defaultOpts.cleanEnv
+	o.strictSchema = defaultOpts.strictSchema
+	o.validators = defaultOpts.validators
+	o.check = defaultOpts.check
+	o.selfCheck = defaultOpts.selfCheck
 	o.inputSchema = defaultOpts.inputSchema
 	o.outputSchema = defaultOpts.outputSchema
 	o.runDir = defaultOpts.runDir
+	o.workDir = defaultOpts.workDir
+	o.runDirPolicy = defaultOpts.runDirPolicy
 	o.stdout = defaultOpts.stdout
 	o.stderr = defaultOpts.stderr
 
@@ -50,6 +72,14 @@ func WithExecAgentPrompt(opt string) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.prompt = opt }
 }
 
+func WithExecAgentPromptTemplate(opt string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.promptTemplate = opt }
+}
+
+func WithExecAgentPromptVars(opt map[string]any) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.promptVars = opt }
+}
+
 func WithExecAgentExtraArgs(opt ...string) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.extraArgs = append(o.extraArgs, opt...) }
 }
@@ -58,10 +88,78 @@ func WithExecAgentUseTTY(opt bool) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.useTTY = opt }
 }
 
+func WithExecAgentPromptDelivery(opt ainvoke.PromptDelivery) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.promptDelivery = opt }
+}
+
+func WithExecAgentInlineInput(opt bool) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.inlineInput = opt }
+}
+
+func WithExecAgentOutputSource(opt ainvoke.OutputSource) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.outputSource = opt }
+}
+
 func WithExecAgentTimeout(opt time.Duration) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.timeout = opt }
 }
 
+func WithExecAgentGracePeriod(opt time.Duration) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.gracePeriod = opt }
+}
+
+func WithExecAgentIdleTimeout(opt time.Duration) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.idleTimeout = opt }
+}
+
+func WithExecAgentEarlyExit(opt bool) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.earlyExit = opt }
+}
+
+func WithExecAgentNormalizers(opt ...ainvoke.Normalizer) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.normalizers = append(o.normalizers, opt...) }
+}
+
+func WithExecAgentLimits(opt ainvoke.ResourceLimits) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.limits = opt }
+}
+
+func WithExecAgentSandbox(opt *ainvoke.Sandbox) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.sandbox = opt }
+}
+
+func WithExecAgentEnv(opt map[string]string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.env = opt }
+}
+
+func WithExecAgentEnvAllow(opt ...string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.envAllow = append(o.envAllow, opt...) }
+}
+
+func WithExecAgentEnvDeny(opt ...string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.envDeny = append(o.envDeny, opt...) }
+}
+
+func WithExecAgentCleanEnv(opt bool) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.cleanEnv = opt }
+}
+
+func WithExecAgentStrictSchema(opt bool) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.strictSchema = opt }
+}
+
+func WithExecAgentValidators(opt ...ainvoke.Validator) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.validators = append(o.validators, opt...) }
+}
+
+func WithExecAgentCheck(opt *ainvoke.AcceptanceCheck) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.check = opt }
+}
+
+func WithExecAgentSelfCheck(opt string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.selfCheck = opt }
+}
+
 func WithExecAgentInputSchema(opt string) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.inputSchema = opt }
 }
@@ -74,6 +172,14 @@ func WithExecAgentRunDir(opt string) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.runDir = opt }
 }
 
+func WithExecAgentWorkDir(opt string) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.workDir = opt }
+}
+
+func WithExecAgentRunDirPolicy(opt ainvoke.RunDirPolicy) OptExecAgentOptionsSetter {
+	return func(o *ExecAgentOptions) { o.runDirPolicy = opt }
+}
+
 func WithExecAgentStdout(opt io.Writer) OptExecAgentOptionsSetter {
 	return func(o *ExecAgentOptions) { o.stdout = opt }
 }
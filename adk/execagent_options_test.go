@@ -3,6 +3,8 @@ package adk
 import (
 	"testing"
 	"time"
+
+	"github.com/metalagman/ainvoke"
 )
 
 func TestNewExecAgent(t *testing.T) {
@@ -22,15 +24,56 @@ func TestNewExecAgent(t *testing.T) {
 			name: "with all options",
 			options: []OptExecAgentOptionsSetter{
 				WithExecAgentPrompt("test prompt"),
+				WithExecAgentPromptTemplate("{{ .Vars.rules }}\n" + ainvoke.DefaultPromptTemplate),
+				WithExecAgentPromptVars(map[string]any{"rules": "Be brief."}),
 				WithExecAgentUseTTY(true),
+				WithExecAgentPromptDelivery(ainvoke.PromptFile),
+				WithExecAgentInlineInput(true),
+				WithExecAgentOutputSource(ainvoke.OutputSourceStdout),
 				WithExecAgentTimeout(30 * time.Second),
+				WithExecAgentGracePeriod(time.Second),
+				WithExecAgentIdleTimeout(10 * time.Second),
+				WithExecAgentEarlyExit(true),
+				WithExecAgentNormalizers(ainvoke.DefaultNormalizers()...),
+				WithExecAgentLimits(ainvoke.ResourceLimits{OpenFiles: 256}),
+				WithExecAgentSandbox(&ainvoke.Sandbox{DisableNetwork: true}),
+				WithExecAgentEnv(map[string]string{"API_KEY": "key"}),
+				WithExecAgentEnvAllow("PATH", "HOME"),
+				WithExecAgentEnvDeny("*_TOKEN"),
+				WithExecAgentCleanEnv(false),
+				WithExecAgentStrictSchema(true),
+				WithExecAgentValidators(ainvoke.NewValidator("noop", nil)),
+				WithExecAgentCheck(&ainvoke.AcceptanceCheck{Cmd: []string{"go", "test", "./..."}, Retries: 2}),
+				WithExecAgentSelfCheck("ainvoke check"),
 				WithExecAgentInputSchema(`{"type":"string"}`),
 				WithExecAgentOutputSchema(`{"type":"string"}`),
 				WithExecAgentRunDir("./test-work"),
+				WithExecAgentWorkDir("./test-repo"),
 				WithExecAgentExtraArgs("arg1", "arg2"),
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid prompt delivery",
+			options: []OptExecAgentOptionsSetter{
+				WithExecAgentPromptDelivery(ainvoke.PromptPlaceholder),
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed output schema",
+			options: []OptExecAgentOptionsSetter{
+				WithExecAgentOutputSchema(`{"type":"object","required":"output"}`),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid prompt template",
+			options: []OptExecAgentOptionsSetter{
+				WithExecAgentPromptTemplate("{{ .Prompt }}"),
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
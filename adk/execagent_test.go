@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/metalagman/ainvoke"
 	"google.golang.org/adk/agent"
 	"google.golang.org/adk/session"
 	"google.golang.org/genai"
@@ -108,7 +109,7 @@ func TestExecAgent(t *testing.T) {
 			input:   `{"name": "World"}`,
 			timeout: 10 * time.Millisecond,
 			// helloagent doesn't sleep, so we might need a slow agent to test timeout
-			expected: "signal: killed",
+			expected: "agent timed out",
 		},
 		{
 			name:     "custom schema raw output",
@@ -413,6 +414,101 @@ func TestExecAgent_CustomRunDir(t *testing.T) {
 	}
 }
 
+func TestExecAgent_WorkDir(t *testing.T) {
+	runDir := t.TempDir()
+	workDir := t.TempDir()
+
+	script := `out=$(sed -n 's/^- Write output JSON to: //p'); printf '{"output":"%s"}' "$(pwd)" > "$out"`
+	a, err := NewExecAgent("TestExecAgentWorkDir", "Testing ExecAgent with work dir", []string{"sh", "-c", script},
+		WithExecAgentRunDir(runDir),
+		WithExecAgentWorkDir(workDir),
+	)
+	if err != nil {
+		t.Fatalf("failed to create exec agent: %v", err)
+	}
+
+	ctx := &mockInvocationContext{
+		Context:     context.Background(),
+		userContent: genai.NewContentFromText("hi", genai.RoleUser),
+	}
+
+	wantDir, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		t.Fatalf("eval symlinks: %v", err)
+	}
+
+	found := false
+	for event, err := range a.Run(ctx) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := event.LLMResponse.Content.Parts[0].Text; got != wantDir {
+			t.Errorf("got %q, want %q", got, wantDir)
+		}
+		found = true
+	}
+
+	if !found {
+		t.Error("expected an event")
+	}
+
+	if _, err := os.Stat(filepath.Join(workDir, "input.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no input.json in work dir, stat err = %v", err)
+	}
+}
+
+func TestExecAgent_ManagedRunDir(t *testing.T) {
+	base := t.TempDir()
+
+	script := `out=$(sed -n 's/^- Write output JSON to: //p'); printf '{"output":"managed"}' > "$out"`
+	a, err := NewExecAgent("TestExecAgentManagedRunDir", "Testing ExecAgent with managed run dirs", []string{"sh", "-c", script},
+		WithExecAgentRunDir(base),
+		WithExecAgentRunDirPolicy(ainvoke.RunDirPolicy{Cleanup: ainvoke.CleanupAlways}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create exec agent: %v", err)
+	}
+
+	ctx := &mockInvocationContext{
+		Context:     context.Background(),
+		userContent: genai.NewContentFromText("hi", genai.RoleUser),
+	}
+
+	found := false
+	for event, err := range a.Run(ctx) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := event.LLMResponse.Content.Parts[0].Text; got != "managed" {
+			t.Errorf("got %q, want %q", got, "managed")
+		}
+		found = true
+	}
+
+	if !found {
+		t.Error("expected an event")
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		t.Fatalf("read base dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected run dirs to be cleaned up, found %d", len(entries))
+	}
+}
+
+func TestExecAgent_KeepLastNeedsRunDir(t *testing.T) {
+	_, err := NewExecAgent("TestExecAgentKeepLast", "Testing keep-last without a run dir", []string{"true"},
+		WithExecAgentRunDirPolicy(ainvoke.RunDirPolicy{Cleanup: ainvoke.CleanupKeepLast, KeepLast: 1}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "requires a run dir") {
+		t.Fatalf("expected error for keep-last without a run dir, got %v", err)
+	}
+}
+
 func TestExecAgent_MissingRunDir(t *testing.T) {
 	tmpDir := t.TempDir()
 	origDir, _ := os.Getwd()
@@ -458,6 +554,36 @@ func TestExecAgent_MissingRunDir(t *testing.T) {
 	}
 }
 
+func TestNewAdapterAgent(t *testing.T) {
+	a, err := NewAdapterAgent("claude", "claude agent", ainvoke.ClaudeAdapter, ainvoke.AdapterOptions{Model: "sonnet"})
+	if err != nil {
+		t.Fatalf("NewAdapterAgent failed: %v", err)
+	}
+
+	if want := []string{"claude", "-p", "--model", "sonnet"}; !reflect.DeepEqual(a.opts.cmd, want) {
+		t.Errorf("expected cmd %v, got %v", want, a.opts.cmd)
+	}
+
+	if a.opts.promptDelivery != ainvoke.PromptArg || a.opts.useTTY {
+		t.Errorf("expected arg delivery without TTY, got %q, %v", a.opts.promptDelivery, a.opts.useTTY)
+	}
+
+	a, err = NewAdapterAgent(
+		"claude",
+		"claude agent",
+		ainvoke.ClaudeAdapter,
+		ainvoke.AdapterOptions{},
+		WithExecAgentPromptDelivery(ainvoke.PromptFile),
+	)
+	if err != nil {
+		t.Fatalf("NewAdapterAgent failed: %v", err)
+	}
+
+	if a.opts.promptDelivery != ainvoke.PromptFile {
+		t.Errorf("expected the setter to override prompt delivery, got %q", a.opts.promptDelivery)
+	}
+}
+
 func TestGetUserInput(t *testing.T) {
 	t.Run("with content", func(t *testing.T) {
 		ctx := &mockInvocationContext{
@@ -4,6 +4,7 @@ package ainvoke
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,8 +12,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/xeipuuv/gojsonschema"
@@ -27,17 +29,33 @@ const inputFilePerm = 0o644
 
 // Invocation describes where the runner should read inputs and write outputs.
 // RunDir is an ephemeral directory managed by the callee.
+// WorkDir is the directory the agent process runs in; it defaults to RunDir.
+// Keeping them apart leaves input.json and output.json out of the workspace.
 type Invocation struct {
 	RunDir       string
+	WorkDir      string
 	SystemPrompt string
 	Input        any
 	InputSchema  string
 	OutputSchema string
+
+	// inputCompiled and outputCompiled are the compiled schemas of a run,
+	// set by Execute.
+	inputCompiled  *Schema
+	outputCompiled *Schema
 }
 
 type ExecRunner struct {
-	cmd    []string
-	useTTY bool
+	cmd            []string
+	useTTY         bool
+	promptDelivery PromptDelivery
+	inlineInput    bool
+	outputSource   OutputSource
+	envOpt         []RunOption
+	// inputSchema and outputSchema are compiled once by NewRunner and used
+	// by every invocation that does not bring its own schema.
+	inputSchema  *Schema
+	outputSchema *Schema
 }
 
 // NewRunner constructs a runner for the given agent config.
@@ -46,59 +64,298 @@ func NewRunner(cfg AgentConfig) (*ExecRunner, error) {
 		return nil, fmt.Errorf("agent requires cmd")
 	}
 
-	return &ExecRunner{cmd: cfg.Cmd, useTTY: cfg.UseTTY}, nil
+	if err := cfg.PromptDelivery.validate(cfg.Cmd); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.OutputSource.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateEnv(cfg.Env, cfg.EnvAllow, cfg.EnvDeny); err != nil {
+		return nil, fmt.Errorf("agent env: %w", err)
+	}
+
+	inputSchema, err := compileConfigSchema(cfg.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+
+	outputSchema, err := compileConfigSchema(cfg.OutputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+
+	return &ExecRunner{
+		cmd:            cfg.Cmd,
+		useTTY:         cfg.UseTTY,
+		promptDelivery: cfg.PromptDelivery,
+		inlineInput:    cfg.InlineInput,
+		outputSource:   cfg.OutputSource,
+		envOpt: []RunOption{
+			WithEnv(cfg.Env),
+			WithEnvAllow(cfg.EnvAllow...),
+			WithEnvDeny(cfg.EnvDeny...),
+			WithCleanEnv(cfg.CleanEnv),
+		},
+		inputSchema:  inputSchema,
+		outputSchema: outputSchema,
+	}, nil
 }
 
+// compileConfigSchema compiles a schema from AgentConfig; an empty one is
+// left unset.
+func compileConfigSchema(text string) (*Schema, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return CompileSchema(text)
+}
+
+// Run implements Runner on top of Execute.
 func (r *ExecRunner) Run(
 	ctx context.Context,
 	inv Invocation,
 	opts ...RunOption,
 ) (outBytes, errBytes []byte, exitCode int, err error) {
-	if inv.RunDir == "" {
-		inv.RunDir = "."
-	}
+	res, err := r.Execute(ctx, inv, opts...)
 
-	absRunDir, err := filepath.Abs(inv.RunDir)
+	return res.Stdout, res.Stderr, res.ExitCode, err
+}
+
+// Execute runs the agent and returns a Result describing the run. The Result
+// is never nil, and is filled in as far as the run got when an error is
+// returned.
+func (r *ExecRunner) Execute(ctx context.Context, inv Invocation, opts ...RunOption) (res *Result, err error) {
+	res = &Result{Argv: append([]string(nil), r.cmd...), RunID: rand.Text()}
+	start := time.Now()
+
+	defer func() { res.Duration = time.Since(start) }()
+
+	opts = slices.Concat([]RunOption{WithTTY(r.useTTY)}, r.envOpt, opts)
+
+	runOpts, err := resolveRunOptions(opts)
 	if err != nil {
-		return nil, nil, 0, fmt.Errorf("absolute path for rundir: %w", err)
+		return res, fmt.Errorf("resolve options: %w", err)
 	}
 
-	inv.RunDir = absRunDir
+	if inv.InputSchema == "" && r.inputSchema != nil {
+		inv.InputSchema = r.inputSchema.String()
+	}
 
-	if len(opts) == 0 {
-		opts = append(opts, WithTTY(r.useTTY))
-	} else {
-		opts = append([]RunOption{WithTTY(r.useTTY)}, opts...)
+	if inv.OutputSchema == "" && r.outputSchema != nil {
+		inv.OutputSchema = r.outputSchema.String()
 	}
 
+	if runOpts.strictSchema {
+		if err := strictInvocation(&inv); err != nil {
+			return res, fmt.Errorf("strict schema: %w", err)
+		}
+	}
+
+	if inv.inputCompiled, err = reuseSchema(r.inputSchema, inv.InputSchema); err != nil {
+		return res, newRunError(PhaseInputValidation, res, fmt.Errorf("validate input schema: %w", err))
+	}
+
+	if inv.outputCompiled, err = reuseSchema(r.outputSchema, inv.OutputSchema); err != nil {
+		return res, newRunError(PhaseOutputValidation, res, fmt.Errorf("validate output schema: %w", err))
+	}
+
+	if runOpts.runDirPolicy != nil {
+		runDir, createErr := createRunDir(inv.RunDir, *runOpts.runDirPolicy)
+		if createErr != nil {
+			return res, fmt.Errorf("create run dir: %w", createErr)
+		}
+
+		inv.RunDir = runDir
+
+		defer func() {
+			if cleanupErr := finishRunDir(runDir, *runOpts.runDirPolicy, err == nil); cleanupErr != nil {
+				err = errors.Join(err, fmt.Errorf("clean up run dir: %w", cleanupErr))
+			}
+		}()
+	}
+
+	if err := resolveDirs(&inv); err != nil {
+		return res, err
+	}
+
+	res.setPaths(inv)
+
 	if err := writeInput(inv); err != nil {
-		return nil, nil, 0, fmt.Errorf("write input: %w", err)
+		return res, fmt.Errorf("write input: %w", err)
 	}
 
-	prompt, err := agentPrompt(inv)
+	res.InputSchemaPath, res.OutputSchemaPath, err = writeSchemas(inv)
 	if err != nil {
-		return nil, nil, 0, fmt.Errorf("agent prompt: %w", err)
+		return res, fmt.Errorf("write schemas: %w", err)
 	}
 
-	runOpts, err := resolveRunOptions(opts)
+	prompt, err := agentPrompt(inv, promptOptions{
+		template:     runOpts.promptTemplate,
+		vars:         runOpts.promptVars,
+		inlineInput:  r.inlineInput,
+		stdoutOutput: r.outputSource == OutputSourceStdout,
+		selfCheck:    runOpts.selfCheck,
+	})
 	if err != nil {
-		return nil, nil, 0, fmt.Errorf("resolve options: %w", err)
+		return res, fmt.Errorf("agent prompt: %w", err)
 	}
 
-	outBytes, errBytes, exitCode, err = r.runWithOptions(ctx, inv, []byte(prompt), runOpts)
-	if err != nil {
-		if exitCode != 0 {
-			err = fmt.Errorf("exit code %d: %w", exitCode, errors.Join(ErrRunFailed, err))
+	return res, r.runAttempts(ctx, inv, prompt, runOpts, res)
+}
+
+// runAttempts invokes the agent and, when repair is enabled, re-invokes it
+// with a follow-up prompt until the output validates or attempts run out.
+func (r *ExecRunner) runAttempts(
+	ctx context.Context,
+	inv Invocation,
+	prompt string,
+	runOpts RunOptions,
+	res *Result,
+) error {
+	res.Prompt = prompt
+	repairs, checkRetries := 0, 0
+
+	for attempt := 1; ; attempt++ {
+		runCtx, idle, stopIdle := watchIdle(ctx, inv.RunDir, runOpts.idleTimeout)
+		runCtx, stopOutput := watchOutput(runCtx, inv, runOpts.earlyCompletion)
+
+		attemptOpts := runOpts
+		if idle != nil {
+			attemptOpts.stdout = io.MultiWriter(runOpts.stdout, idle)
+			attemptOpts.stderr = io.MultiWriter(runOpts.stderr, idle)
 		}
 
-		return outBytes, errBytes, exitCode, err
+		argv, stdin, err := r.deliverPrompt(inv.RunDir, res.Prompt)
+		if err != nil {
+			stopOutput()
+			stopIdle()
+
+			return fmt.Errorf("deliver prompt: %w", err)
+		}
+
+		res.Argv = argv
+
+		proc, err := r.runWithOptions(runCtx, inv, argv, stdin, attemptOpts, res.contractEnv())
+		res.Stdout, res.Stderr, res.ExitCode = proc.stdout, proc.stderr, proc.exitCode
+		res.Usage = res.Usage.add(proc.usage)
+		stopOutput()
+		stopIdle()
+
+		if err != nil && errors.Is(context.Cause(runCtx), errOutputReady) {
+			res.EarlyCompletion = true
+			err = nil
+		}
+
+		if err != nil {
+			phase := PhaseProcessStart
+
+			switch {
+			case ctx.Err() != nil:
+				phase = PhaseProcessExit
+				err = interruptError(ctx, err)
+			case errors.Is(context.Cause(runCtx), ErrIdleTimeout):
+				phase = PhaseProcessExit
+				err = idle.error(err)
+			case res.ExitCode != 0:
+				phase = PhaseProcessExit
+				err = fmt.Errorf("exit code %d: %w", res.ExitCode, errors.Join(ErrRunFailed, err))
+			}
+
+			res.Attempts = append(res.Attempts, Attempt{Errors: []string{err.Error()}})
+
+			return newRunError(phase, res, err)
+		}
+
+		res.Normalizations = nil
+		output, outErr := r.processOutput(ctx, inv, res, runOpts.normalizers, runOpts.validators)
+		res.Attempts = append(res.Attempts, Attempt{
+			Errors:         outputProblems(outErr),
+			Normalizations: res.Normalizations,
+		})
+
+		if outErr == nil {
+			res.Output = output
+
+			if runOpts.acceptanceCheck == nil {
+				return nil
+			}
+
+			retryPrompt, err := r.acceptOutput(ctx, inv, prompt, runOpts, res, attempt, checkRetries)
+			if err != nil || retryPrompt == "" {
+				return err
+			}
+
+			checkRetries++
+			res.Prompt = retryPrompt
+		} else {
+			if repairs >= runOpts.repairAttempts || !isRepairable(outErr) {
+				return newRunError(outputPhase(outErr), res, outErr)
+			}
+
+			repairs++
+
+			res.Prompt, err = repairPrompt(prompt, inv, attempt, outErr, r.outputSource == OutputSourceStdout)
+			if err != nil {
+				return fmt.Errorf("repair prompt: %w", err)
+			}
+		}
+
+		if err := removeStaleOutput(inv.RunDir); err != nil {
+			return fmt.Errorf("remove stale output: %w", err)
+		}
+	}
+}
+
+// interruptError reports an agent stopped because ctx is done, telling a
+// timeout apart from a cancellation.
+func interruptError(ctx context.Context, err error) error {
+	sentinel := ErrCanceled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		sentinel = ErrTimeout
+	}
+
+	return fmt.Errorf("%w (%w): %w", sentinel, context.Cause(ctx), err)
+}
+
+// resolveDirs makes RunDir and WorkDir absolute, defaulting RunDir to the
+// current directory and WorkDir to RunDir.
+func resolveDirs(inv *Invocation) error {
+	if inv.RunDir == "" {
+		inv.RunDir = "."
+	}
+
+	absRunDir, err := filepath.Abs(inv.RunDir)
+	if err != nil {
+		return fmt.Errorf("absolute path for rundir: %w", err)
 	}
 
-	if err := r.processOutput(inv); err != nil {
-		return outBytes, errBytes, exitCode, err
+	inv.RunDir = absRunDir
+
+	if inv.WorkDir == "" {
+		inv.WorkDir = absRunDir
+
+		return nil
 	}
 
-	return outBytes, errBytes, exitCode, nil
+	return resolveWorkDir(inv)
+}
+
+func resolveWorkDir(inv *Invocation) error {
+	absWorkDir, err := filepath.Abs(inv.WorkDir)
+	if err != nil {
+		return fmt.Errorf("absolute path for workdir: %w", err)
+	}
+
+	if _, err := os.Stat(absWorkDir); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrMissingWorkDir, absWorkDir, err)
+	}
+
+	inv.WorkDir = absWorkDir
+
+	return nil
 }
 
 func removeStaleOutput(runDir string) error {
@@ -110,46 +367,104 @@ func removeStaleOutput(runDir string) error {
 	return nil
 }
 
-func (r *ExecRunner) processOutput(inv Invocation) error {
+// processOutput reads and validates the output of the attempt described by
+// res, taking it from stdout as the output source allows.
+func (r *ExecRunner) processOutput(
+	ctx context.Context,
+	inv Invocation,
+	res *Result,
+	normalizers []Normalizer,
+	validators []Validator,
+) ([]byte, error) {
 	outputPath, err := filepath.Abs(filepath.Join(inv.RunDir, OutputFileName))
 	if err != nil {
-		return fmt.Errorf("absolute output path: %w", err)
+		return nil, fmt.Errorf("absolute output path: %w", err)
+	}
+
+	_, statErr := os.Stat(outputPath)
+	if r.outputSource == OutputSourceStdout || (r.outputSource == OutputSourceFileThenStdout && statErr != nil) {
+		if err := saveStdoutOutput(res.Stdout, res.Prompt, inv, outputPath); err != nil {
+			if statErr != nil && r.outputSource == OutputSourceFileThenStdout {
+				return nil, fmt.Errorf("%w: %s: %v; %w", ErrMissingOutput, outputPath, statErr, err)
+			}
+
+			return nil, err
+		}
+
+		_, statErr = os.Stat(outputPath)
 	}
 
-	if _, err := os.Stat(outputPath); err != nil {
-		return fmt.Errorf("%w: %s: %v", ErrMissingOutput, outputPath, err)
+	if statErr != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrMissingOutput, outputPath, statErr)
 	}
 
-	if err := validateOutputSchema(inv.OutputSchema, outputPath); err != nil {
-		return fmt.Errorf("validate output: %w", err)
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", outputPath, err)
 	}
 
-	return nil
+	if len(normalizers) > 0 {
+		normalized, applied := normalizeOutput(data, inv.OutputSchema, normalizers)
+		if len(applied) > 0 {
+			if err := os.WriteFile(outputPath, normalized, inputFilePerm); err != nil {
+				return nil, fmt.Errorf("write normalized output: %w", err)
+			}
+
+			data = normalized
+		}
+
+		res.Normalizations = applied
+	}
+
+	if err := inv.validateOutput(data); err != nil {
+		return nil, fmt.Errorf("validate output: %w", err)
+	}
+
+	if err := runValidators(ctx, inv, data, validators); err != nil {
+		return nil, fmt.Errorf("validate output: %w", err)
+	}
+
+	return data, nil
 }
 
 func (r *ExecRunner) runWithOptions(
 	ctx context.Context,
 	inv Invocation,
+	argv []string,
 	stdin []byte,
 	runOpts RunOptions,
-) (outBytes, errBytes []byte, exitCode int, err error) {
+	contract map[string]string,
+) (processResult, error) {
+	proc := processOptions{
+		grace:   runOpts.gracePeriod,
+		limits:  runOpts.resourceLimits,
+		sandbox: runOpts.sandbox,
+		env:     agentEnv(os.Environ(), runOpts, contract),
+	}
+
+	if runOpts.sandbox != nil {
+		proc.writable = append([]string{inv.RunDir, inv.WorkDir}, runOpts.sandbox.WritablePaths...)
+	}
+
 	if runOpts.tty {
 		return runCommandWithTTY(
 			ctx,
-			r.cmd,
-			inv.RunDir,
+			argv,
+			inv.WorkDir,
 			stdin,
 			runOpts.stdout,
+			proc,
 		)
 	}
 
 	return runCommand(
 		ctx,
-		r.cmd,
-		inv.RunDir,
+		argv,
+		inv.WorkDir,
 		stdin,
 		runOpts.stdout,
 		runOpts.stderr,
+		proc,
 	)
 }
 
@@ -166,11 +481,11 @@ func writeInput(inv Invocation) error {
 	if inv.Input == nil {
 		data, err := os.ReadFile(inputPath)
 		if err != nil {
-			return fmt.Errorf("%w: %s: %v", ErrMissingInput, inputPath, err)
+			return newRunError(PhaseInputValidation, nil, fmt.Errorf("%w: %s: %v", ErrMissingInput, inputPath, err))
 		}
 
-		if err := validateInputSchema(inv.InputSchema, data); err != nil {
-			return fmt.Errorf("validate input: %w", err)
+		if err := inv.validateInput(data); err != nil {
+			return newRunError(PhaseInputValidation, nil, fmt.Errorf("validate input: %w", err))
 		}
 
 		return removeStaleOutput(inv.RunDir)
@@ -181,8 +496,8 @@ func writeInput(inv Invocation) error {
 		return fmt.Errorf("marshal input: %w", err)
 	}
 
-	if err := validateInputSchema(inv.InputSchema, data); err != nil {
-		return fmt.Errorf("validate input: %w", err)
+	if err := inv.validateInput(data); err != nil {
+		return newRunError(PhaseInputValidation, nil, fmt.Errorf("validate input: %w", err))
 	}
 
 	if err := os.WriteFile(inputPath, data, inputFilePerm); err != nil {
@@ -196,59 +511,162 @@ func writeInput(inv Invocation) error {
 	return nil
 }
 
-func validateInputSchema(schema string, data []byte) error {
-	if strings.TrimSpace(schema) == "" {
-		return ErrInputSchemaEmpty
+// writeSchemas writes the input and output schemas next to input.json so
+// agents can read them from AINVOKE_INPUT_SCHEMA_PATH and
+// AINVOKE_OUTPUT_SCHEMA_PATH.
+func writeSchemas(inv Invocation) (inputPath, outputPath string, err error) {
+	inputPath = filepath.Join(inv.RunDir, InputSchemaFileName)
+	if err := os.WriteFile(inputPath, []byte(inv.InputSchema), inputFilePerm); err != nil {
+		return "", "", fmt.Errorf("write %s: %w", inputPath, err)
 	}
 
-	schemaLoader := gojsonschema.NewStringLoader(schema)
-	docLoader := gojsonschema.NewBytesLoader(data)
+	outputPath = filepath.Join(inv.RunDir, OutputSchemaFileName)
+	if err := os.WriteFile(outputPath, []byte(inv.OutputSchema), inputFilePerm); err != nil {
+		return "", "", fmt.Errorf("write %s: %w", outputPath, err)
+	}
+
+	return inputPath, outputPath, nil
+}
+
+// validateInput validates data against the input schema of inv, using the
+// compiled schema of the run when there is one.
+func (inv Invocation) validateInput(data []byte) error {
+	if strings.TrimSpace(inv.InputSchema) == "" {
+		return ErrInputSchemaEmpty
+	}
 
-	result, err := gojsonschema.Validate(schemaLoader, docLoader)
+	schema, err := reuseSchema(inv.inputCompiled, inv.InputSchema)
 	if err != nil {
 		return fmt.Errorf("validate input schema: %w", err)
 	}
 
-	if result.Valid() {
-		return nil
+	return schema.ValidateInput(data)
+}
+
+// validateOutput validates data against the output schema of inv, using the
+// compiled schema of the run when there is one.
+func (inv Invocation) validateOutput(data []byte) error {
+	if strings.TrimSpace(inv.OutputSchema) == "" {
+		return ErrOutputSchemaEmpty
 	}
 
-	errs := make([]string, 0, len(result.Errors()))
-	for _, err := range result.Errors() {
-		errs = append(errs, err.String())
+	schema, err := reuseSchema(inv.outputCompiled, inv.OutputSchema)
+	if err != nil {
+		return fmt.Errorf("validate output schema: %w", err)
 	}
 
-	return fmt.Errorf("%w: %s", ErrInputSchemaInvalid, strings.Join(errs, "; "))
+	return schema.Validate(data)
 }
 
-func validateOutputSchema(schema, outputPath string) error {
-	if strings.TrimSpace(schema) == "" {
-		return ErrOutputSchemaEmpty
+// validateOutput validates data against the output schema text.
+func validateOutput(schema string, data []byte) error {
+	return Invocation{OutputSchema: schema}.validateOutput(data)
+}
+
+func validationFailure(err gojsonschema.ResultError) ValidationFailure {
+	segments := strings.Split(err.Context().String("\x00"), "\x00")[1:]
+
+	switch err.Type() {
+	case "required", "additional_property_not_allowed":
+		if property, ok := err.Details()["property"].(string); ok {
+			segments = append(segments, property)
+		}
 	}
 
-	data, err := os.ReadFile(outputPath)
-	if err != nil {
-		return fmt.Errorf("read %s: %w", outputPath, err)
+	keyword, ok := schemaKeywords[err.Type()]
+	if !ok {
+		keyword = err.Type()
 	}
 
-	schemaLoader := gojsonschema.NewStringLoader(schema)
-	docLoader := gojsonschema.NewBytesLoader(data)
+	return ValidationFailure{
+		Pointer: jsonPointer(segments),
+		Keyword: keyword,
+		Message: err.Description(),
+	}
+}
 
-	result, err := gojsonschema.Validate(schemaLoader, docLoader)
-	if err != nil {
-		return fmt.Errorf("validate output schema: %w", err)
+// jsonPointer encodes path segments as an RFC 6901 JSON pointer.
+func jsonPointer(segments []string) string {
+	var b strings.Builder
+
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, segment := range segments {
+		b.WriteByte('/')
+		b.WriteString(escaper.Replace(segment))
 	}
 
-	if result.Valid() {
-		return nil
+	return b.String()
+}
+
+// schemaKeywords maps gojsonschema error types to the schema keyword that
+// produced them.
+var schemaKeywords = map[string]string{
+	"false":                           "false",
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// processOptions configures how the agent process is run.
+type processOptions struct {
+	grace  time.Duration
+	limits ResourceLimits
+	// sandbox, when set, confines the agent; writable lists the paths that
+	// stay writable inside it.
+	sandbox  *Sandbox
+	writable []string
+	// env is the agent environment; nil inherits the parent environment.
+	env []string
+}
+
+// processResult is what a finished agent process left behind.
+type processResult struct {
+	stdout   []byte
+	stderr   []byte
+	exitCode int
+	usage    *Usage
+}
+
+// prepareCommand applies the process options that change how cmd is
+// executed. A command that cannot be found is reported here, before any
+// wrapper replaces its path.
+func prepareCommand(cmd *exec.Cmd, proc processOptions) error {
+	if cmd.Err != nil {
+		return fmt.Errorf("cmd run: %w", cmd.Err)
 	}
 
-	errs := make([]string, 0, len(result.Errors()))
-	for _, err := range result.Errors() {
-		errs = append(errs, err.String())
+	if err := wrapInit(cmd, proc); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("%w: %s", ErrOutputSchemaInvalid, strings.Join(errs, "; "))
+	return nil
 }
 
 func runCommand(
@@ -258,14 +676,21 @@ func runCommand(
 	stdin []byte,
 	stdoutSink io.Writer,
 	stderrSink io.Writer,
-) (stdoutBytes, stderrBytes []byte, exitCode int, err error) {
+	proc processOptions,
+) (processResult, error) {
 	if len(argv) == 0 {
-		return nil, nil, 0, fmt.Errorf("agent command is empty")
+		return processResult{}, fmt.Errorf("agent command is empty")
 	}
 
 	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Dir = workDir
+	cmd.Env = proc.env
 	cmd.Stdin = bytes.NewReader(stdin)
+	group := newProcessGroup(cmd, proc.grace, true)
+
+	if err := prepareCommand(cmd, proc); err != nil {
+		return processResult{}, err
+	}
 
 	var (
 		stdout bytes.Buffer
@@ -284,15 +709,32 @@ func runCommand(
 		cmd.Stderr = &stderr
 	}
 
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The agent exited successfully; a child it left behind kept the
+		// output pipes open.
+		err = nil
+	}
+
+	group.wait()
+
+	res := processResult{
+		stdout: stdout.Bytes(),
+		stderr: stderr.Bytes(),
+		usage:  processUsage(cmd.ProcessState),
+	}
+
+	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return stdout.Bytes(), stderr.Bytes(), exitErr.ExitCode(), err
+			res.exitCode = exitErr.ExitCode()
+
+			return res, err
 		}
 
-		return stdout.Bytes(), stderr.Bytes(), 0, fmt.Errorf("cmd run: %w", err)
+		return res, fmt.Errorf("cmd run: %w", err)
 	}
 
-	return stdout.Bytes(), stderr.Bytes(), 0, nil
+	return res, nil
 }
 
 func runCommandWithTTY(
@@ -301,17 +743,26 @@ func runCommandWithTTY(
 	workDir string,
 	stdin []byte,
 	stdoutSink io.Writer,
-) (stdoutBytes, stderrBytes []byte, exitCode int, err error) {
+	proc processOptions,
+) (processResult, error) {
 	if len(argv) == 0 {
-		return nil, nil, 0, fmt.Errorf("agent command is empty")
+		return processResult{}, fmt.Errorf("agent command is empty")
 	}
 
 	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Dir = workDir
+	cmd.Env = proc.env
+	// pty.Start puts the agent in a new session, which also makes it the
+	// leader of a new process group.
+	group := newProcessGroup(cmd, proc.grace, false)
+
+	if err := prepareCommand(cmd, proc); err != nil {
+		return processResult{}, err
+	}
 
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
-		return nil, nil, 0, fmt.Errorf("start pty: %w", err)
+		return processResult{}, fmt.Errorf("start pty: %w", err)
 	}
 
 	var out bytes.Buffer
@@ -336,8 +787,9 @@ func runCommandWithTTY(
 		if _, err := ptmx.Write(stdin); err != nil {
 			_ = ptmx.Close()
 			_ = cmd.Wait()
+			group.wait()
 
-			return out.Bytes(), nil, 0, fmt.Errorf("write stdin: %w", err)
+			return processResult{stdout: out.Bytes()}, fmt.Errorf("write stdin: %w", err)
 		}
 	}
 
@@ -346,87 +798,19 @@ func runCommandWithTTY(
 	_ = ptmx.Close()
 
 	<-done
+	group.wait()
 
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return out.Bytes(), nil, exitErr.ExitCode(), err
-		}
-
-		return out.Bytes(), nil, 0, fmt.Errorf("cmd wait: %w", err)
-	}
-
-	return out.Bytes(), nil, 0, nil
-}
-
-func agentPrompt(inv Invocation) (string, error) {
-	inputPath, err := filepath.Abs(filepath.Join(inv.RunDir, InputFileName))
-	if err != nil {
-		return "", fmt.Errorf("absolute input path: %w", err)
-	}
+	res := processResult{stdout: out.Bytes(), usage: processUsage(cmd.ProcessState)}
 
-	outputPath, err := filepath.Abs(filepath.Join(inv.RunDir, OutputFileName))
 	if err != nil {
-		return "", fmt.Errorf("absolute output path: %w", err)
-	}
-
-	if _, err := os.Stat(inputPath); err != nil {
-		return "", fmt.Errorf("stat %s: %w", inputPath, err)
-	}
-
-	if strings.TrimSpace(inv.InputSchema) == "" {
-		return "", ErrInputSchemaEmpty
-	}
-
-	if strings.TrimSpace(inv.OutputSchema) == "" {
-		return "", ErrOutputSchemaEmpty
-	}
-
-	data := promptData{
-		SystemPrompt: inv.SystemPrompt,
-		InputPath:    inputPath,
-		InputSchema:  inv.InputSchema,
-		OutputSchema: inv.OutputSchema,
-		OutputPath:   outputPath,
-	}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			res.exitCode = exitErr.ExitCode()
 
-	tmpl, err := template.New("prompt").Parse(promptTemplate)
-	if err != nil {
-		return "", fmt.Errorf("parse prompt template: %w", err)
-	}
+			return res, err
+		}
 
-	var b bytes.Buffer
-	if err := tmpl.Execute(&b, data); err != nil {
-		return "", fmt.Errorf("render prompt template: %w", err)
+		return res, fmt.Errorf("cmd wait: %w", err)
 	}
 
-	return b.String(), nil
-}
-
-type promptData struct {
-	SystemPrompt string
-	InputPath    string
-	InputSchema  string
-	OutputSchema string
-	OutputPath   string
+	return res, nil
 }
-
-var promptTemplate = `{{- if .SystemPrompt -}}
-System Prompt:
-{{ .SystemPrompt }}
-
-{{- end -}}
-I/O Requirements:
-- Read input JSON schema (text below).
-- Read output JSON schema (text below).
-- Read input JSON from: {{ .InputPath }}
-- Produce output JSON that conforms to the output schema.
-- Write output JSON to: {{ .OutputPath }}
-
-Input JSON Schema:
-{{ .InputSchema }}
-
-Output JSON Schema:
-{{ .OutputSchema }}
-
-Note: Input JSON content is provided via the input file path above.
-`
@@ -0,0 +1,221 @@
+package ainvoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// BundleSchemaFile reads the JSON schema at path and inlines the local files
+// it references. A "$ref" such as "common/address.json" or
+// "common/address.json#/properties/street" is resolved relative to the file
+// containing it unless it is an absolute path; each referenced file is copied once into the root
+// "definitions" and the reference is rewritten to point there. References
+// within the root file and remote URLs are kept as they are.
+//
+// The result is self-contained, so it can be compiled from a string and shown
+// to an agent, which cannot follow references either. A file without local
+// file references is returned unchanged.
+func BundleSchemaFile(path string) (string, error) {
+	rootPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("absolute schema path: %w", err)
+	}
+
+	data, err := os.ReadFile(rootPath)
+	if err != nil {
+		return "", fmt.Errorf("read schema: %w", err)
+	}
+
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return "", fmt.Errorf("parse schema %s: %w", path, err)
+	}
+
+	b := &schemaBundler{
+		rootPath: rootPath,
+		names:    make(map[string]string),
+		defs:     make(map[string]any),
+	}
+
+	doc, _ := root.(map[string]any)
+	if defs, ok := doc["definitions"].(map[string]any); ok {
+		for name := range defs {
+			b.taken = append(b.taken, name)
+		}
+	}
+
+	if err := b.rewrite(root, rootPath, ""); err != nil {
+		return "", err
+	}
+
+	if len(b.defs) == 0 {
+		return string(data), nil
+	}
+
+	if doc == nil {
+		return "", fmt.Errorf("schema %s: file references need an object schema", path)
+	}
+
+	defs, _ := doc["definitions"].(map[string]any)
+	if defs == nil {
+		defs = make(map[string]any, len(b.defs))
+		doc["definitions"] = defs
+	}
+
+	for name, def := range b.defs {
+		defs[name] = def
+	}
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal schema: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// schemaBundler collects the files referenced from a root schema.
+type schemaBundler struct {
+	rootPath string
+	// names maps the absolute path of each inlined file to its definition
+	// name; defs holds the inlined documents by name.
+	names map[string]string
+	defs  map[string]any
+	taken []string
+}
+
+// rewrite walks node, which belongs to the file at file, and rewrites every
+// file reference. prefix is the pointer of the file's copy in the bundle.
+func (b *schemaBundler) rewrite(node any, file, prefix string) error {
+	switch value := node.(type) {
+	case []any:
+		for _, item := range value {
+			if err := b.rewrite(item, file, prefix); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		// Sorted keys keep the definition names of colliding files stable.
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			item := value[key]
+			if key == "$ref" {
+				ref, ok := item.(string)
+				if !ok {
+					continue
+				}
+
+				resolved, err := b.resolve(ref, file, prefix)
+				if err != nil {
+					return err
+				}
+
+				value[key] = resolved
+
+				continue
+			}
+
+			if err := b.rewrite(item, file, prefix); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the bundle-local form of ref found in file.
+func (b *schemaBundler) resolve(ref, file, prefix string) (string, error) {
+	target, fragment, _ := strings.Cut(ref, "#")
+
+	if target == "" {
+		// A fragment within the same file.
+		return "#" + prefix + fragment, nil
+	}
+
+	if u, err := url.Parse(target); err == nil && u.Scheme != "" {
+		return ref, nil
+	}
+
+	targetPath := filepath.FromSlash(target)
+	if !filepath.IsAbs(targetPath) {
+		targetPath = filepath.Join(filepath.Dir(file), targetPath)
+	}
+	if targetPath == b.rootPath {
+		return "#" + fragment, nil
+	}
+
+	name, err := b.include(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("resolve $ref %q in %s: %w", ref, file, err)
+	}
+
+	return "#/definitions/" + name + fragment, nil
+}
+
+// include inlines the file at path, once, and returns its definition name.
+func (b *schemaBundler) include(path string) (string, error) {
+	if name, ok := b.names[path]; ok {
+		return name, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if schema, ok := doc.(map[string]any); ok {
+		// An inlined document must not change the base URI of its refs.
+		delete(schema, "$id")
+		delete(schema, "id")
+		delete(schema, "$schema")
+	}
+
+	name := b.definitionName(path)
+	b.names[path] = name
+	b.defs[name] = doc
+
+	if err := b.rewrite(doc, path, "/definitions/"+name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+var definitionNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// definitionName derives a readable, unused definition name from path, e.g.
+// "common_address" for common/address.json next to the root schema.
+func (b *schemaBundler) definitionName(path string) string {
+	rel, err := filepath.Rel(filepath.Dir(b.rootPath), path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+	base := strings.Trim(definitionNameUnsafe.ReplaceAllString(rel, "_"), "_")
+
+	if base == "" {
+		base = "schema"
+	}
+
+	name := base
+	for i := 2; slices.Contains(b.taken, name); i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	b.taken = append(b.taken, name)
+
+	return name
+}
@@ -0,0 +1,152 @@
+package ainvoke
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundleSchemaFile(t *testing.T) {
+	bundled, err := BundleSchemaFile(filepath.Join("testdata", "schemas", "order.json"))
+	if err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+
+	var doc struct {
+		Properties  map[string]map[string]any `json:"properties"`
+		Definitions map[string]map[string]any `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte(bundled), &doc); err != nil {
+		t.Fatalf("parse bundle: %v", err)
+	}
+
+	refs := map[string]string{
+		"shipping": "#/definitions/common_address",
+		"billing":  "#/definitions/common_address",
+		"street":   "#/definitions/common_address/properties/street",
+	}
+	for name, want := range refs {
+		if got := doc.Properties[name]["$ref"]; got != want {
+			t.Errorf("expected %s to reference %s, got %v", name, want, got)
+		}
+	}
+
+	for _, name := range []string{"item", "common_address", "common_country"} {
+		if _, ok := doc.Definitions[name]; !ok {
+			t.Errorf("expected definition %s in %s", name, bundled)
+		}
+	}
+
+	if _, ok := doc.Definitions["common_address"]["$id"]; ok {
+		t.Error("expected $id to be dropped from inlined schema")
+	}
+
+	schema, err := CompileSchema(bundled)
+	if err != nil {
+		t.Fatalf("compile bundle: %v", err)
+	}
+
+	valid := `{"shipping":{"street":"Main St","country":"DE","parts":["a"]},"street":"x","items":["a"]}`
+	if err := schema.Validate([]byte(valid)); err != nil {
+		t.Fatalf("expected valid document, got %v", err)
+	}
+
+	invalid := `{"shipping":{"street":"Main St","country":"XX","parts":[1]}}`
+	var validationErr *ValidationError
+	if err := schema.Validate([]byte(invalid)); !errors.As(err, &validationErr) || len(validationErr.Failures) != 2 {
+		t.Fatalf("expected country and parts failures, got %v", err)
+	}
+}
+
+func TestBundleSchemaFileEdgeCases(t *testing.T) {
+	dir := t.TempDir()
+	plain := `{"type":"object","properties":{"a":{"$ref":"#/definitions/a"}},"definitions":{"a":{"type":"string"}}}`
+	writeFile(t, dir, "plain.json", plain)
+
+	got, err := BundleSchemaFile(filepath.Join(dir, "plain.json"))
+	if err != nil || got != plain {
+		t.Fatalf("expected file without file references unchanged, got %s, %v", got, err)
+	}
+
+	writeFile(t, dir, "tree.json", `{"type":"object","properties":{"child":{"$ref":"node.json"}}}`)
+	writeFile(
+		t,
+		dir,
+		"node.json",
+		`{"type":"object","properties":{"child":{"$ref":"node.json"},"root":{"$ref":"tree.json"}}}`,
+	)
+
+	got, err = BundleSchemaFile(filepath.Join(dir, "tree.json"))
+	if err != nil {
+		t.Fatalf("bundle recursive schema: %v", err)
+	}
+
+	if !strings.Contains(got, `"$ref": "#/definitions/node"`) || !strings.Contains(got, `"$ref": "#"`) {
+		t.Fatalf("expected recursive references to be rewritten, got %s", got)
+	}
+
+	if _, err := CompileSchema(got); err != nil {
+		t.Fatalf("compile recursive bundle: %v", err)
+	}
+
+	writeFile(t, dir, "broken.json", `{"$ref":"missing.json"}`)
+
+	if _, err := BundleSchemaFile(filepath.Join(dir, "broken.json")); err == nil ||
+		!strings.Contains(err.Error(), "missing.json") {
+		t.Fatalf("expected error naming the missing file, got %v", err)
+	}
+}
+
+func TestBundleSchemaFileNames(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a-b.json", `{"type":"string"}`)
+	writeFile(t, dir, "a_b.json", `{"type":"integer"}`)
+	writeFile(t, dir, "root.json", `{"type":"object","properties":{"x":{"$ref":"a-b.json"},"y":{"$ref":"a_b.json"}}}`)
+
+	for range 20 {
+		got, err := BundleSchemaFile(filepath.Join(dir, "root.json"))
+		if err != nil {
+			t.Fatalf("bundle: %v", err)
+		}
+
+		var doc struct {
+			Properties  map[string]map[string]any `json:"properties"`
+			Definitions map[string]map[string]any `json:"definitions"`
+		}
+		if err := json.Unmarshal([]byte(got), &doc); err != nil {
+			t.Fatalf("parse bundle: %v", err)
+		}
+
+		if doc.Properties["x"]["$ref"] != "#/definitions/a_b" || doc.Properties["y"]["$ref"] != "#/definitions/a_b_2" {
+			t.Fatalf("expected a-b.json as a_b and a_b.json as a_b_2, got %s", got)
+		}
+
+		if doc.Definitions["a_b_2"]["type"] != "integer" {
+			t.Fatalf("expected a_b_2 to hold a_b.json, got %s", got)
+		}
+	}
+}
+
+func TestBundleSchemaFileAbsoluteRef(t *testing.T) {
+	shared := filepath.Join(t.TempDir(), "shared.json")
+	writeFile(t, filepath.Dir(shared), "shared.json", `{"type":"string"}`)
+
+	dir := t.TempDir()
+	writeFile(t, dir, "root.json", `{"type":"object","properties":{"a":{"$ref":"`+filepath.ToSlash(shared)+`"}}}`)
+
+	got, err := BundleSchemaFile(filepath.Join(dir, "root.json"))
+	if err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+
+	schema, err := CompileSchema(got)
+	if err != nil {
+		t.Fatalf("compile bundle: %v", err)
+	}
+
+	if err := schema.Validate([]byte(`{"a":1}`)); !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected the inlined string schema to reject a number, got %v in %s", err, got)
+	}
+}
@@ -0,0 +1,213 @@
+package ainvoke
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// checkFeedbackSize bounds the check output quoted in a retry prompt.
+const checkFeedbackSize = 8 << 10
+
+// AcceptanceCheck is a command that decides whether the agent finished its
+// task, such as "go test ./...". It runs in the work directory after the
+// output passed validation, with the agent's environment including the
+// AINVOKE_* variables. A non-zero exit fails the check.
+type AcceptanceCheck struct {
+	// Cmd is the command and its arguments.
+	Cmd []string
+	// Retries is how many times the agent is re-invoked with the check output
+	// appended to the prompt after a failed check.
+	Retries int
+	// Timeout bounds each run of the check; zero leaves only the run context.
+	Timeout time.Duration
+}
+
+func (c AcceptanceCheck) validate() error {
+	if len(c.Cmd) == 0 {
+		return errors.New("command is empty")
+	}
+
+	if c.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+
+	return nil
+}
+
+// CheckResult records one run of the acceptance check.
+type CheckResult struct {
+	// Attempt is the agent attempt the check ran after, starting at 1.
+	Attempt  int
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+	Duration time.Duration
+}
+
+// Passed reports whether the check exited with code zero.
+func (c CheckResult) Passed() bool {
+	return c.ExitCode == 0
+}
+
+// acceptOutput runs the acceptance check after attempt produced valid output.
+// It returns an empty prompt when the check passed, or the prompt for the next
+// attempt when retries remain.
+func (r *ExecRunner) acceptOutput(
+	ctx context.Context,
+	inv Invocation,
+	prompt string,
+	runOpts RunOptions,
+	res *Result,
+	attempt int,
+	retries int,
+) (string, error) {
+	check, err := runCheck(ctx, inv, runOpts, res, attempt)
+	res.Checks = append(res.Checks, check)
+
+	switch {
+	case err != nil:
+		return "", newRunError(PhaseAcceptanceCheck, res, err)
+	case ctx.Err() != nil:
+		return "", newRunError(PhaseAcceptanceCheck, res, interruptError(ctx, ctx.Err()))
+	case check.Passed():
+		return "", nil
+	}
+
+	res.Output = nil
+	checkErr := checkError(*runOpts.acceptanceCheck, check)
+	res.Attempts[len(res.Attempts)-1].Errors = []string{checkErr.Error()}
+
+	if retries >= runOpts.acceptanceCheck.Retries {
+		return "", newRunError(PhaseAcceptanceCheck, res, checkErr)
+	}
+
+	next, err := checkPrompt(prompt, *runOpts.acceptanceCheck, check, res.OutputPath, r.outputSource == OutputSourceStdout)
+	if err != nil {
+		return "", fmt.Errorf("check prompt: %w", err)
+	}
+
+	return next, nil
+}
+
+// runCheck runs the acceptance check for attempt. An error means the check
+// could not be run; a failing check is reported in the result only.
+func runCheck(
+	ctx context.Context,
+	inv Invocation,
+	runOpts RunOptions,
+	res *Result,
+	attempt int,
+) (CheckResult, error) {
+	check := runOpts.acceptanceCheck
+
+	if check.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, check.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	proc, err := runCommand(ctx, check.Cmd, inv.WorkDir, nil, runOpts.stdout, runOpts.stderr, processOptions{
+		grace: runOpts.gracePeriod,
+		env:   agentEnv(os.Environ(), runOpts, res.contractEnv()),
+	})
+
+	result := CheckResult{
+		Attempt:  attempt,
+		ExitCode: proc.exitCode,
+		Stdout:   proc.stdout,
+		Stderr:   proc.stderr,
+		Duration: time.Since(start),
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return result, fmt.Errorf("run acceptance check: %w", err)
+	}
+
+	return result, nil
+}
+
+// checkError describes a failed check.
+func checkError(check AcceptanceCheck, result CheckResult) error {
+	return fmt.Errorf(
+		"%w: %s exited with code %d: %s",
+		ErrCheckFailed,
+		strings.Join(check.Cmd, " "),
+		result.ExitCode,
+		tail(checkOutput(result), stderrTailSize),
+	)
+}
+
+// checkOutput returns the stdout and stderr of a check run.
+func checkOutput(result CheckResult) []byte {
+	return bytes.TrimSpace(append(append([]byte(nil), result.Stdout...), result.Stderr...))
+}
+
+// checkPrompt extends the original prompt with the output of a failed check.
+func checkPrompt(
+	prompt string,
+	check AcceptanceCheck,
+	result CheckResult,
+	outputPath string,
+	stdoutOutput bool,
+) (string, error) {
+	tmpl, err := template.New("check").Parse(checkPromptTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse check template: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(prompt)
+
+	err = tmpl.Execute(&b, checkData{
+		Attempt:      result.Attempt,
+		Command:      strings.Join(check.Cmd, " "),
+		ExitCode:     result.ExitCode,
+		Output:       tail(checkOutput(result), checkFeedbackSize),
+		OutputPath:   outputPath,
+		StdoutOutput: stdoutOutput,
+	})
+	if err != nil {
+		return "", fmt.Errorf("render check template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+type checkData struct {
+	Attempt      int
+	Command      string
+	ExitCode     int
+	Output       string
+	OutputPath   string
+	StdoutOutput bool
+}
+
+var checkPromptTemplate = `
+Acceptance Check Failed:
+After attempt {{ .Attempt }}, the acceptance check ` + "`{{ .Command }}`" + ` exited with code {{ .ExitCode }}.
+{{- if .Output }}
+
+Check output:
+{{ .Output }}
+{{- end }}
+
+{{ if .StdoutOutput -}}
+Continue the task in the workspace until the check passes, then print the output JSON again to stdout in a fenced code block starting with a ` + "```json" + ` line and ending with a ` + "```" + ` line.
+{{ else -}}
+Continue the task in the workspace until the check passes, then write the output JSON again to: {{ .OutputPath }}
+{{ end -}}
+`
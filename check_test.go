@@ -0,0 +1,92 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunAcceptanceCheck(t *testing.T) {
+	script := `if grep -q "Acceptance Check Failed" prompt.md; then touch done; fi
+printf '{"result":"ok"}' > "$AINVOKE_OUTPUT_PATH"`
+
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", script}, PromptDelivery: PromptFile})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	check := AcceptanceCheck{
+		Cmd:     []string{"sh", "-c", `grep -q ok "$AINVOKE_OUTPUT_PATH" && test -f done || { echo "task not done"; exit 3; }`},
+		Retries: 1,
+	}
+
+	res, err := runner.Execute(
+		context.Background(),
+		helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+		WithAcceptanceCheck(check),
+	)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if len(res.Checks) != 2 || res.Checks[0].Passed() || !res.Checks[1].Passed() {
+		t.Fatalf("expected a failed then a passed check, got %+v", res.Checks)
+	}
+
+	if res.Checks[0].ExitCode != 3 || res.Checks[0].Attempt != 1 || res.Checks[1].Attempt != 2 {
+		t.Fatalf("unexpected check results %+v", res.Checks)
+	}
+
+	if len(res.Attempts) != 2 || !strings.Contains(res.Attempts[0].Errors[0], "task not done") {
+		t.Fatalf("expected the check failure in the first attempt, got %+v", res.Attempts)
+	}
+
+	if !strings.Contains(res.Prompt, "exited with code 3") || !strings.Contains(res.Prompt, "task not done") {
+		t.Fatalf("expected the check output in the retry prompt, got:\n%s", res.Prompt)
+	}
+
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Fatalf("unexpected output %s", res.Output)
+	}
+}
+
+func TestRunAcceptanceCheckFailure(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"result":"ok"}' > "$AINVOKE_OUTPUT_PATH"`)
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+
+	res, err := Execute(
+		context.Background(),
+		runner,
+		inv,
+		WithAcceptanceCheck(AcceptanceCheck{Cmd: []string{"sh", "-c", "echo FAIL: TestX; exit 1"}}),
+	)
+	if !errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("expected ErrCheckFailed, got %v", err)
+	}
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Phase != PhaseAcceptanceCheck || !strings.Contains(err.Error(), "FAIL: TestX") {
+		t.Fatalf("expected acceptance check RunError with the check output, got %v", err)
+	}
+
+	if len(res.Checks) != 1 || res.Output != nil {
+		t.Fatalf("expected one check and no output, got %+v, %s", res.Checks, res.Output)
+	}
+
+	_, err = Execute(
+		context.Background(),
+		runner,
+		inv,
+		WithAcceptanceCheck(AcceptanceCheck{Cmd: []string{"ainvoke-no-such-check"}, Retries: 2}),
+	)
+	if err == nil || errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("expected error running the check, got %v", err)
+	}
+
+	for _, check := range []AcceptanceCheck{{}, {Cmd: []string{"true"}, Retries: -1}, {Cmd: []string{"true"}, Timeout: -1}} {
+		if _, err := Execute(context.Background(), runner, inv, WithAcceptanceCheck(check)); err == nil {
+			t.Errorf("expected error for %+v", check)
+		}
+	}
+}
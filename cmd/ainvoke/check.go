@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/metalagman/ainvoke"
+	"github.com/spf13/cobra"
+)
+
+func newCheckCmd() *cobra.Command {
+	var schemaFile string
+
+	cmd := &cobra.Command{
+		Use:   "check [file]",
+		Short: "Validate an output file against the output schema of the current invocation",
+		Long: "Validate an output file (default: $" + ainvoke.EnvOutputPath + ") against the output schema " +
+			"(default: $" + ainvoke.EnvOutputSchemaPath + ") and print the violations.\n" +
+			"Agents run it before finishing to catch mistakes within the same invocation.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outputPath := os.Getenv(ainvoke.EnvOutputPath)
+			if len(args) > 0 {
+				outputPath = args[0]
+			}
+
+			if schemaFile == "" {
+				schemaFile = os.Getenv(ainvoke.EnvOutputSchemaPath)
+			}
+
+			return checkOutputFile(cmd, outputPath, schemaFile)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&schemaFile,
+		"schema-file",
+		"",
+		"output JSON schema file (default: $"+ainvoke.EnvOutputSchemaPath+")",
+	)
+
+	return cmd
+}
+
+// selfCheckCommand returns the shell command that runs "check" with this
+// binary, so agents do not depend on ainvoke being on their PATH.
+func selfCheckCommand() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "ainvoke check"
+	}
+
+	return shellQuote(exe) + " check"
+}
+
+// shellSafeChars never need quoting in a POSIX shell word.
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./+:@"
+
+// shellQuote quotes s for a POSIX shell unless it only has safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafeChars) == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func checkOutputFile(cmd *cobra.Command, outputPath, schemaFile string) error {
+	if outputPath == "" {
+		return fmt.Errorf("no file given and $%s is not set", ainvoke.EnvOutputPath)
+	}
+
+	if schemaFile == "" {
+		return fmt.Errorf("no --schema-file given and $%s is not set", ainvoke.EnvOutputSchemaPath)
+	}
+
+	schemaText, err := ainvoke.BundleSchemaFile(schemaFile)
+	if err != nil {
+		return fmt.Errorf("load schema: %w", err)
+	}
+
+	schema, err := ainvoke.CompileSchema(schemaText)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return fmt.Errorf("read output: %w", err)
+	}
+
+	var validationErr *ainvoke.ValidationError
+	if err := schema.Validate(data); errors.As(err, &validationErr) {
+		out := cmd.OutOrStdout()
+		for _, f := range validationErr.Failures {
+			_, _ = fmt.Fprintln(out, f)
+		}
+
+		return fmt.Errorf("%s: %d problem(s) found", outputPath, len(validationErr.Failures))
+	} else if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "ok: %s matches the output schema\n", outputPath)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/metalagman/ainvoke"
+)
+
+func TestCheckCmd(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "output.schema.json")
+	validPath := filepath.Join(dir, "valid.json")
+	invalidPath := filepath.Join(dir, "invalid.json")
+
+	files := map[string]string{
+		schemaPath:  `{"type":"object","properties":{"result":{"type":"string"}},"required":["result"]}`,
+		validPath:   `{"result":"ok"}`,
+		invalidPath: `{"result":1}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	run := func(args ...string) (string, error) {
+		cmd := newCheckCmd()
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+
+		return out.String(), err
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		out, err := run("--schema-file", schemaPath, validPath)
+		if err != nil || !strings.HasPrefix(out, "ok: ") {
+			t.Fatalf("expected ok, got %q, %v", out, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		out, err := run("--schema-file", schemaPath, invalidPath)
+		if err == nil || !strings.Contains(err.Error(), "1 problem(s) found") {
+			t.Fatalf("expected problems error, got %v", err)
+		}
+
+		if !strings.Contains(out, "/result") {
+			t.Fatalf("expected the failure pointer in the output, got %q", out)
+		}
+	})
+
+	t.Run("env defaults", func(t *testing.T) {
+		t.Setenv(ainvoke.EnvOutputPath, validPath)
+		t.Setenv(ainvoke.EnvOutputSchemaPath, schemaPath)
+
+		if out, err := run(); err != nil || !strings.Contains(out, validPath) {
+			t.Fatalf("expected ok for %s, got %q, %v", validPath, out, err)
+		}
+	})
+
+	t.Run("missing env", func(t *testing.T) {
+		t.Setenv(ainvoke.EnvOutputPath, "")
+		t.Setenv(ainvoke.EnvOutputSchemaPath, "")
+
+		if _, err := run(); err == nil || !strings.Contains(err.Error(), ainvoke.EnvOutputPath) {
+			t.Fatalf("expected missing output path error, got %v", err)
+		}
+
+		if _, err := run(validPath); err == nil || !strings.Contains(err.Error(), ainvoke.EnvOutputSchemaPath) {
+			t.Fatalf("expected missing schema error, got %v", err)
+		}
+	})
+}
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"/usr/local/bin/ainvoke": "/usr/local/bin/ainvoke",
+		"/tmp/my dir/ainvoke":    "'/tmp/my dir/ainvoke'",
+		"/tmp/it's/ainvoke":      `'/tmp/it'\''s/ainvoke'`,
+		"":                       "''",
+	}
+	for in, want := range cases {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
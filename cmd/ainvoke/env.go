@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// agentEnv merges the variables from --env-file files and --env flags, in
+// that order, so a flag overrides a file.
+func agentEnv(files, vars []string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for _, path := range files {
+		if err := readEnvFile(path, env); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kv := range vars {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("parse --env %q: expected KEY=VALUE", kv)
+		}
+
+		env[name] = value
+	}
+
+	if len(env) == 0 {
+		return nil, nil
+	}
+
+	return env, nil
+}
+
+// readEnvFile reads KEY=VALUE lines into env. Blank lines and lines starting
+// with # are skipped, an "export " prefix is allowed, and values may be
+// wrapped in single or double quotes.
+func readEnvFile(path string, env map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read env file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+
+		if !ok || name == "" {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+
+		value, err := unquoteEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+
+		env[name] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read env file: %w", err)
+	}
+
+	return nil
+}
+
+func unquoteEnvValue(value string) (string, error) {
+	if len(value) < 2 {
+		return value, nil
+	}
+
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1], nil
+	}
+
+	return value, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAgentEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	content := "# credentials\nexport API_KEY=from-file\n\nREGION = \"eu-west-1\"\nQUOTED='a b'\nESCAPED=\"line\\nbreak\"\n"
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	env, err := agentEnv([]string{path}, []string{"API_KEY=from-flag", "EMPTY="})
+	if err != nil {
+		t.Fatalf("agentEnv failed: %v", err)
+	}
+
+	want := map[string]string{
+		"API_KEY": "from-flag",
+		"REGION":  "eu-west-1",
+		"QUOTED":  "a b",
+		"ESCAPED": "line\nbreak",
+		"EMPTY":   "",
+	}
+	if !maps.Equal(env, want) {
+		t.Errorf("expected %v, got %v", want, env)
+	}
+
+	if env, err := agentEnv(nil, nil); err != nil || env != nil {
+		t.Errorf("expected no env, got %v, %v", env, err)
+	}
+
+	if _, err := agentEnv(nil, []string{"NOVALUE"}); err == nil {
+		t.Error("expected error for --env without a value")
+	}
+
+	if _, err := agentEnv([]string{filepath.Join(dir, "missing")}, nil); err == nil {
+		t.Error("expected error for a missing env file")
+	}
+
+	if err := os.WriteFile(path, []byte("just text\n"), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	if _, err := agentEnv([]string{path}, nil); err == nil {
+		t.Error("expected error for a malformed env file")
+	}
+}
@@ -1,8 +1,13 @@
 // Package main is the entry point for the ainvoke CLI.
 package main
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/metalagman/ainvoke"
+	"github.com/spf13/cobra"
+)
 
 func main() {
+	ainvoke.MaybeRunInit()
+	ainvoke.RegisterBuiltinFormats()
 	cobra.CheckErr(newRootCmd().Execute())
 }
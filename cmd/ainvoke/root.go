@@ -17,6 +17,7 @@ func newRootCmd() *cobra.Command {
 	root.AddCommand(newOpenCodeCmd())
 	root.AddCommand(newGeminiCmd())
 	root.AddCommand(newClaudeCmd())
+	root.AddCommand(newCheckCmd())
 	root.AddCommand(newQuickstartCmd())
 	root.AddCommand(newVersionCmd())
 
@@ -42,7 +42,7 @@ func TestRootCmd(t *testing.T) {
 		t.Errorf("expected use 'ainvoke', got '%s'", cmd.Use)
 	}
 
-	subCommands := []string{"exec", "codex", "opencode", "gemini", "claude", "quickstart", "version"}
+	subCommands := []string{"exec", "codex", "opencode", "gemini", "claude", "check", "quickstart", "version"}
 	for _, sub := range subCommands {
 		found := false
 		for _, c := range cmd.Commands() {
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,24 +25,85 @@ type agentOptions struct {
 	inputSchemaFile  string
 	outputSchemaFile string
 	prompt           string
+	promptTemplate   string
+	promptVars       []string
+	promptDelivery   string
+	inlineInput      bool
+	outputSource     string
 	input            string
 	workDir          string
+	workspace        string
 	extraArgs        []string
 	useTTY           bool
 	model            string
 	debug            bool
 	timeout          time.Duration
+	gracePeriod      time.Duration
+	idleTimeout      time.Duration
+	earlyExit        bool
+	lenient          bool
+	strictSchema     bool
+	cpuLimit         time.Duration
+	memoryLimit      string
+	openFilesLimit   uint64
+	processLimit     uint64
+	sandbox          bool
+	sandboxNoNetwork bool
+	sandboxWritable  []string
+	checkCmd         string
+	checkRetries     int
+	checkTimeout     time.Duration
+	selfCheck        bool
+	env              []string
+	envFiles         []string
+	envAllow         []string
+	envDeny          []string
+	cleanEnv         bool
+	repairAttempts   int
+	runDirCleanup    string
+	keepRunDirs      int
 }
 
 func addCommonFlags(cmd *cobra.Command, opts *agentOptions, includeTTY bool) {
 	cmd.Flags().StringVar(&opts.inputSchema, "input-schema", defaultInputSchema, "input JSON schema")
 	cmd.Flags().StringVar(&opts.outputSchema, "output-schema", defaultOutputSchema, "output JSON schema")
-	cmd.Flags().StringVar(&opts.inputSchemaFile, "input-schema-file", "", "path to input JSON schema file")
-	cmd.Flags().StringVar(&opts.outputSchemaFile, "output-schema-file", "", "path to output JSON schema file")
+	cmd.Flags().StringVar(&opts.inputSchemaFile, "input-schema-file", "", "path to input JSON schema file; relative $refs to other files are inlined")
+	cmd.Flags().StringVar(&opts.outputSchemaFile, "output-schema-file", "", "path to output JSON schema file; relative $refs to other files are inlined")
 	cmd.Flags().StringVar(&opts.prompt, "prompt", "", "system prompt for the agent")
+	cmd.Flags().StringVar(
+		&opts.promptTemplate,
+		"prompt-template-file",
+		"",
+		"path to a Go text/template that replaces the built-in agent prompt",
+	)
+	cmd.Flags().StringArrayVar(
+		&opts.promptVars,
+		"prompt-var",
+		nil,
+		"variable for the prompt template as KEY=VALUE, available as .Vars.KEY (repeatable)",
+	)
+	cmd.Flags().StringVar(
+		&opts.promptDelivery,
+		"prompt-delivery",
+		string(ainvoke.PromptStdin),
+		"how the prompt reaches the agent: stdin, arg, placeholder ({{prompt}} in the args) or file (prompt.md)",
+	)
+	cmd.Flags().BoolVar(
+		&opts.inlineInput,
+		"inline-input",
+		false,
+		"embed the input JSON in the prompt for agents that cannot read files",
+	)
+	cmd.Flags().StringVar(
+		&opts.outputSource,
+		"output-source",
+		string(ainvoke.OutputSourceFile),
+		"where to take the output from: file (output.json), stdout (JSON printed by the agent) or file-then-stdout",
+	)
 	cmd.Flags().StringVar(&opts.input, "input", "", "input value (string)")
 	cmd.Flags().StringArrayVar(&opts.extraArgs, "extra-args", nil, "extra args to pass to the agent command")
 	cmd.Flags().StringVar(&opts.workDir, "work-dir", ".", "run directory for input/output files")
+	cmd.Flags().StringVar(&opts.workspace, "workspace", "", "directory the agent runs in (defaults to --work-dir)")
 
 	if includeTTY {
 		cmd.Flags().BoolVar(&opts.useTTY, "tty", true, "run the agent in a pseudo-terminal")
@@ -47,6 +111,115 @@ func addCommonFlags(cmd *cobra.Command, opts *agentOptions, includeTTY bool) {
 
 	cmd.Flags().BoolVar(&opts.debug, "debug", false, "forward agent stdout/stderr to stderr")
 	cmd.Flags().DurationVar(&opts.timeout, "timeout", 0, "timeout for the agent execution")
+	cmd.Flags().DurationVar(
+		&opts.idleTimeout,
+		"idle-timeout",
+		0,
+		"stop the agent after this long without output or file changes in the run directory",
+	)
+	cmd.Flags().BoolVar(
+		&opts.earlyExit,
+		"early-exit",
+		false,
+		"stop the agent as soon as it has written a valid output.json",
+	)
+	cmd.Flags().BoolVar(
+		&opts.lenient,
+		"lenient",
+		false,
+		"fix common output mistakes (BOM, markdown fence, trailing commas, bare value) before validation",
+	)
+	cmd.Flags().BoolVar(
+		&opts.strictSchema,
+		"strict-schema",
+		false,
+		"close object schemas, require all properties not marked x-optional and reject unknown formats",
+	)
+	cmd.Flags().DurationVar(
+		&opts.gracePeriod,
+		"grace-period",
+		ainvoke.DefaultGracePeriod,
+		"time the agent process group gets to exit after SIGTERM before it is killed",
+	)
+	cmd.Flags().DurationVar(&opts.cpuLimit, "cpu-limit", 0, "CPU time limit for the agent processes (RLIMIT_CPU)")
+	cmd.Flags().StringVar(
+		&opts.memoryLimit,
+		"memory-limit",
+		"",
+		"address space limit for the agent processes, e.g. 4GiB (RLIMIT_AS)",
+	)
+	cmd.Flags().Uint64Var(&opts.openFilesLimit, "open-files-limit", 0, "open file limit for the agent processes (RLIMIT_NOFILE)")
+	cmd.Flags().Uint64Var(&opts.processLimit, "process-limit", 0, "process limit for the agent user (RLIMIT_NPROC)")
+	cmd.Flags().BoolVar(
+		&opts.sandbox,
+		"sandbox",
+		false,
+		"run the agent in a Linux namespace sandbox with a read-only filesystem and private /tmp",
+	)
+	cmd.Flags().BoolVar(&opts.sandboxNoNetwork, "sandbox-no-network", false, "disable networking inside the sandbox")
+	cmd.Flags().StringArrayVar(
+		&opts.sandboxWritable,
+		"sandbox-writable",
+		nil,
+		"extra absolute path that stays writable inside the sandbox (repeatable)",
+	)
+	cmd.Flags().StringArrayVar(&opts.env, "env", nil, "set an environment variable for the agent as KEY=VALUE (repeatable)")
+	cmd.Flags().StringArrayVar(
+		&opts.envFiles,
+		"env-file",
+		nil,
+		"read KEY=VALUE environment variables for the agent from a file (repeatable)",
+	)
+	cmd.Flags().StringArrayVar(
+		&opts.envAllow,
+		"env-allow",
+		nil,
+		"only pass inherited variables matching this name or glob to the agent (repeatable)",
+	)
+	cmd.Flags().StringArrayVar(
+		&opts.envDeny,
+		"env-deny",
+		nil,
+		"do not pass inherited variables matching this name or glob to the agent (repeatable)",
+	)
+	cmd.Flags().BoolVar(
+		&opts.cleanEnv,
+		"clean-env",
+		false,
+		"start the agent without inheriting any environment variable",
+	)
+	cmd.Flags().IntVar(
+		&opts.repairAttempts,
+		"repair-attempts",
+		0,
+		"re-invoke the agent up to N times when output is missing or invalid",
+	)
+	cmd.Flags().StringVar(
+		&opts.checkCmd,
+		"check-cmd",
+		"",
+		"acceptance check run with sh -c in the workspace after valid output; a non-zero exit fails the run",
+	)
+	cmd.Flags().IntVar(
+		&opts.checkRetries,
+		"check-retries",
+		0,
+		"re-invoke the agent up to N times with the output of a failed --check-cmd",
+	)
+	cmd.Flags().DurationVar(&opts.checkTimeout, "check-timeout", 0, "time limit for each run of --check-cmd")
+	cmd.Flags().BoolVar(
+		&opts.selfCheck,
+		"self-check",
+		false,
+		"tell the agent to validate its output with 'ainvoke check' before finishing",
+	)
+	cmd.Flags().StringVar(
+		&opts.runDirCleanup,
+		"run-dir-cleanup",
+		"",
+		"create a fresh run directory per invocation under --work-dir and clean it up: always, on-success or keep-last",
+	)
+	cmd.Flags().IntVar(&opts.keepRunDirs, "keep-run-dirs", 10, "number of run directories kept by --run-dir-cleanup=keep-last")
 }
 
 func addModelFlag(cmd *cobra.Command, opts *agentOptions, required bool) error {
@@ -77,21 +250,34 @@ func resolveSchema(schemaValue, schemaFile string, schemaSet bool, label string)
 		return "", fmt.Errorf("use --%s-schema or --%s-schema-file, not both", label, label)
 	}
 
-	data, err := os.ReadFile(schemaFile)
+	schema, err := ainvoke.BundleSchemaFile(schemaFile)
 	if err != nil {
-		return "", fmt.Errorf("read %s schema file: %w", label, err)
+		return "", fmt.Errorf("load %s schema file: %w", label, err)
 	}
 
-	return string(data), nil
+	return schema, nil
 }
 
 type runConfig struct {
-	runDir  string
-	runner  ainvoke.Runner
-	inv     ainvoke.Invocation
-	useTTY  bool
-	debug   bool
-	timeout time.Duration
+	runDir         string
+	runner         ainvoke.Runner
+	inv            ainvoke.Invocation
+	useTTY         bool
+	debug          bool
+	timeout        time.Duration
+	gracePeriod    *time.Duration
+	idleTimeout    time.Duration
+	earlyExit      bool
+	lenient        bool
+	strictSchema   bool
+	limits         ainvoke.ResourceLimits
+	sandbox        *ainvoke.Sandbox
+	check          *ainvoke.AcceptanceCheck
+	selfCheck      string
+	promptTemplate *ainvoke.PromptTemplate
+	promptVars     map[string]any
+	repairAttempts int
+	runDirPolicy   *ainvoke.RunDirPolicy
 }
 
 func buildRunConfig(cmd *cobra.Command, agentCmd []string, opts *agentOptions) (runConfig, error) {
@@ -100,6 +286,73 @@ func buildRunConfig(cmd *cobra.Command, agentCmd []string, opts *agentOptions) (
 		runDir = "."
 	}
 
+	var runDirPolicy *ainvoke.RunDirPolicy
+
+	if opts.runDirCleanup != "" {
+		cleanup, err := ainvoke.ParseCleanupPolicy(opts.runDirCleanup)
+		if err != nil {
+			return runConfig{}, err
+		}
+
+		runDirPolicy = &ainvoke.RunDirPolicy{Cleanup: cleanup, KeepLast: opts.keepRunDirs}
+
+		if !cmd.Flags().Changed("work-dir") {
+			if cleanup == ainvoke.CleanupKeepLast {
+				return runConfig{}, errors.New("--run-dir-cleanup=keep-last requires --work-dir")
+			}
+
+			runDir = ""
+		}
+	}
+
+	memoryLimit, err := parseByteSize(opts.memoryLimit)
+	if err != nil {
+		return runConfig{}, fmt.Errorf("parse --memory-limit: %w", err)
+	}
+
+	limits := ainvoke.ResourceLimits{
+		CPUTime:      opts.cpuLimit,
+		AddressSpace: memoryLimit,
+		OpenFiles:    opts.openFilesLimit,
+		Processes:    opts.processLimit,
+	}
+
+	var sandbox *ainvoke.Sandbox
+
+	if opts.sandbox {
+		sandbox = &ainvoke.Sandbox{DisableNetwork: opts.sandboxNoNetwork, WritablePaths: opts.sandboxWritable}
+	} else if opts.sandboxNoNetwork || len(opts.sandboxWritable) > 0 {
+		return runConfig{}, errors.New("--sandbox-no-network and --sandbox-writable require --sandbox")
+	}
+
+	var selfCheck string
+
+	if opts.selfCheck {
+		// The check reads output.json, which the agent is told not to write.
+		if ainvoke.OutputSource(opts.outputSource) == ainvoke.OutputSourceStdout {
+			return runConfig{}, errors.New("--self-check cannot be used with --output-source=stdout")
+		}
+
+		selfCheck = selfCheckCommand()
+	}
+
+	var check *ainvoke.AcceptanceCheck
+
+	if opts.checkCmd != "" {
+		check = &ainvoke.AcceptanceCheck{
+			Cmd:     []string{"sh", "-c", opts.checkCmd},
+			Retries: opts.checkRetries,
+			Timeout: opts.checkTimeout,
+		}
+	} else if opts.checkRetries != 0 || opts.checkTimeout != 0 {
+		return runConfig{}, errors.New("--check-retries and --check-timeout require --check-cmd")
+	}
+
+	var gracePeriod *time.Duration
+	if cmd.Flags().Changed("grace-period") {
+		gracePeriod = &opts.gracePeriod
+	}
+
 	inputSchemaSet := cmd.Flags().Changed("input-schema")
 	outputSchemaSet := cmd.Flags().Changed("output-schema")
 
@@ -113,9 +366,28 @@ func buildRunConfig(cmd *cobra.Command, agentCmd []string, opts *agentOptions) (
 		return runConfig{}, err
 	}
 
+	promptTemplate, promptVars, err := resolvePromptTemplate(opts.promptTemplate, opts.promptVars)
+	if err != nil {
+		return runConfig{}, err
+	}
+
+	env, err := agentEnv(opts.envFiles, opts.env)
+	if err != nil {
+		return runConfig{}, err
+	}
+
 	agentCfg := ainvoke.AgentConfig{
-		Cmd:    agentCmd,
-		UseTTY: opts.useTTY,
+		Cmd:            agentCmd,
+		UseTTY:         opts.useTTY,
+		PromptDelivery: ainvoke.PromptDelivery(opts.promptDelivery),
+		InlineInput:    opts.inlineInput,
+		OutputSource:   ainvoke.OutputSource(opts.outputSource),
+		Env:            env,
+		EnvAllow:       opts.envAllow,
+		EnvDeny:        opts.envDeny,
+		CleanEnv:       opts.cleanEnv,
+		InputSchema:    finalInputSchema,
+		OutputSchema:   finalOutputSchema,
 	}
 
 	runner, err := ainvoke.NewRunner(agentCfg)
@@ -125,9 +397,8 @@ func buildRunConfig(cmd *cobra.Command, agentCmd []string, opts *agentOptions) (
 
 	inv := ainvoke.Invocation{
 		RunDir:       runDir,
+		WorkDir:      opts.workspace,
 		SystemPrompt: opts.prompt,
-		InputSchema:  finalInputSchema,
-		OutputSchema: finalOutputSchema,
 	}
 	if cmd.Flags().Changed("input") {
 		input, err := parseInputValue(opts.input)
@@ -145,15 +416,63 @@ func buildRunConfig(cmd *cobra.Command, agentCmd []string, opts *agentOptions) (
 	}
 
 	return runConfig{
-		runDir:  runDir,
-		runner:  runner,
-		inv:     inv,
-		useTTY:  agentCfg.UseTTY,
-		debug:   opts.debug,
-		timeout: opts.timeout,
+		runDir:         runDir,
+		runner:         runner,
+		inv:            inv,
+		useTTY:         agentCfg.UseTTY,
+		debug:          opts.debug,
+		timeout:        opts.timeout,
+		gracePeriod:    gracePeriod,
+		idleTimeout:    opts.idleTimeout,
+		earlyExit:      opts.earlyExit,
+		lenient:        opts.lenient,
+		strictSchema:   opts.strictSchema,
+		limits:         limits,
+		sandbox:        sandbox,
+		check:          check,
+		selfCheck:      selfCheck,
+		promptTemplate: promptTemplate,
+		promptVars:     promptVars,
+		repairAttempts: opts.repairAttempts,
+		runDirPolicy:   runDirPolicy,
 	}, nil
 }
 
+// resolvePromptTemplate loads and checks the --prompt-template-file template
+// and parses the --prompt-var values.
+func resolvePromptTemplate(path string, vars []string) (*ainvoke.PromptTemplate, map[string]any, error) {
+	var promptVars map[string]any
+
+	for _, kv := range vars {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			return nil, nil, fmt.Errorf("parse --prompt-var %q: expected KEY=VALUE", kv)
+		}
+
+		if promptVars == nil {
+			promptVars = make(map[string]any, len(vars))
+		}
+
+		promptVars[name] = value
+	}
+
+	if path == "" {
+		return nil, promptVars, nil
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read prompt template file: %w", err)
+	}
+
+	tmpl, err := ainvoke.NewPromptTemplate(string(text))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return tmpl, promptVars, nil
+}
+
 func parseInputValue(raw string) (any, error) {
 	trimmed := strings.TrimSpace(raw)
 	if trimmed == "" {
@@ -186,6 +505,58 @@ func runAndEmit(ctx context.Context, cfg runConfig) error {
 		runOpts = append(runOpts, ainvoke.WithStdout(os.Stderr), ainvoke.WithStderr(os.Stderr))
 	}
 
+	if cfg.repairAttempts > 0 {
+		runOpts = append(runOpts, ainvoke.WithRepairAttempts(cfg.repairAttempts))
+	}
+
+	if cfg.runDirPolicy != nil {
+		runOpts = append(runOpts, ainvoke.WithManagedRunDir(*cfg.runDirPolicy))
+	}
+
+	if cfg.idleTimeout > 0 {
+		runOpts = append(runOpts, ainvoke.WithIdleTimeout(cfg.idleTimeout))
+	}
+
+	if cfg.earlyExit {
+		runOpts = append(runOpts, ainvoke.WithEarlyCompletion(true))
+	}
+
+	if cfg.lenient {
+		runOpts = append(runOpts, ainvoke.WithNormalizers(ainvoke.DefaultNormalizers()...))
+	}
+
+	if cfg.strictSchema {
+		runOpts = append(runOpts, ainvoke.WithStrictSchema(true))
+	}
+
+	if cfg.limits != (ainvoke.ResourceLimits{}) {
+		runOpts = append(runOpts, ainvoke.WithResourceLimits(cfg.limits))
+	}
+
+	if cfg.sandbox != nil {
+		runOpts = append(runOpts, ainvoke.WithSandbox(*cfg.sandbox))
+	}
+
+	if cfg.check != nil {
+		runOpts = append(runOpts, ainvoke.WithAcceptanceCheck(*cfg.check))
+	}
+
+	if cfg.selfCheck != "" {
+		runOpts = append(runOpts, ainvoke.WithSelfCheck(cfg.selfCheck))
+	}
+
+	if cfg.promptTemplate != nil {
+		runOpts = append(runOpts, ainvoke.WithPromptTemplate(cfg.promptTemplate))
+	}
+
+	if len(cfg.promptVars) > 0 {
+		runOpts = append(runOpts, ainvoke.WithPromptVars(cfg.promptVars))
+	}
+
+	if cfg.gracePeriod != nil {
+		runOpts = append(runOpts, ainvoke.WithGracePeriod(*cfg.gracePeriod))
+	}
+
 	if cfg.timeout > 0 {
 		var cancel context.CancelFunc
 
@@ -193,18 +564,29 @@ func runAndEmit(ctx context.Context, cfg runConfig) error {
 		defer cancel()
 	}
 
-	outBytes, errBytes, exitCode, err := cfg.runner.Run(ctx, cfg.inv, runOpts...)
+	res, err := ainvoke.Execute(ctx, cfg.runner, cfg.inv, runOpts...)
+	if cfg.debug {
+		printAttempts(res.Attempts)
+		printNormalizations(res.Normalizations)
+		printChecks(res.Checks)
+		printUsage(res.Usage)
+	}
+
 	if err != nil {
-		if !cfg.useTTY && len(errBytes) == 0 && len(outBytes) > 0 {
-			errBytes = outBytes
+		errBytes := res.Stderr
+		if !cfg.useTTY {
+			errBytes = res.Diagnostics()
 		}
 
-		return exitWithError(exitCode, errBytes, fmt.Errorf("run invocation: %w", err))
+		return exitWithError(res.ExitCode, errBytes, fmt.Errorf("run invocation: %w", err))
 	}
 
-	output, err := readOutput(cfg.runDir)
-	if err != nil {
-		return exitWithError(1, nil, fmt.Errorf("read output: %w", err))
+	output := res.Output
+	if output == nil {
+		output, err = readOutput(cfg.runDir)
+		if err != nil {
+			return exitWithError(1, nil, fmt.Errorf("read output: %w", err))
+		}
 	}
 
 	if _, err := os.Stdout.Write(output); err != nil {
@@ -214,6 +596,96 @@ func runAndEmit(ctx context.Context, cfg runConfig) error {
 	return nil
 }
 
+func printAttempts(attempts []ainvoke.Attempt) {
+	if len(attempts) < 2 {
+		return
+	}
+
+	for i, attempt := range attempts {
+		if len(attempt.Errors) == 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "attempt %d: ok\n", i+1)
+
+			continue
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "attempt %d: %s\n", i+1, strings.Join(attempt.Errors, "; "))
+	}
+}
+
+func printNormalizations(steps []string) {
+	if len(steps) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "normalized output: %s\n", strings.Join(steps, ", "))
+}
+
+func printChecks(checks []ainvoke.CheckResult) {
+	for i, check := range checks {
+		status := "ok"
+		if !check.Passed() {
+			status = fmt.Sprintf("exit code %d", check.ExitCode)
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "check %d (attempt %d): %s in %s\n", i+1, check.Attempt, status, check.Duration)
+	}
+}
+
+func printUsage(usage *ainvoke.Usage) {
+	if usage == nil {
+		return
+	}
+
+	_, _ = fmt.Fprintf(
+		os.Stderr,
+		"usage: user %s, sys %s, max rss %d bytes, context switches %d voluntary, %d involuntary\n",
+		usage.UserTime,
+		usage.SystemTime,
+		usage.MaxRSS,
+		usage.VoluntaryContextSwitches,
+		usage.InvoluntaryContextSwitches,
+	)
+}
+
+// parseByteSize parses a byte count with an optional K, M, G or T suffix,
+// optionally followed by "i" and/or "B". Suffixes are powers of 1024.
+func parseByteSize(raw string) (uint64, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return 0, nil
+	}
+
+	value = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(value), "B"), "I")
+
+	shift := 0
+
+	switch {
+	case strings.HasSuffix(value, "K"):
+		shift = 10
+	case strings.HasSuffix(value, "M"):
+		shift = 20
+	case strings.HasSuffix(value, "G"):
+		shift = 30
+	case strings.HasSuffix(value, "T"):
+		shift = 40
+	}
+
+	if shift > 0 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+
+	if n > math.MaxUint64>>shift {
+		return 0, fmt.Errorf("size %q is too large", raw)
+	}
+
+	return n << shift, nil
+}
+
 func readOutput(runDir string) ([]byte, error) {
 	outputPath := filepath.Join(runDir, ainvoke.OutputFileName)
 
@@ -79,6 +79,14 @@ func TestResolveSchema(t *testing.T) {
 			}
 		})
 	}
+
+	bundled, err := resolveSchema("", filepath.Join("..", "..", "testdata", "schemas", "order.json"), false, "output")
+	if err != nil {
+		t.Fatalf("resolveSchema() with refs: %v", err)
+	}
+	if !strings.Contains(bundled, `"$ref": "#/definitions/common_address"`) {
+		t.Errorf("expected file references to be bundled, got %s", bundled)
+	}
 }
 
 func TestParseInputValue(t *testing.T) {
@@ -168,6 +176,333 @@ func TestBuildRunConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("workspace", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: defaultOutputSchema,
+			workDir:      "run",
+			workspace:    "repo",
+		}
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		if cfg.inv.RunDir != "run" {
+			t.Errorf("expected run dir %q, got %q", "run", cfg.inv.RunDir)
+		}
+		if cfg.inv.WorkDir != "repo" {
+			t.Errorf("expected work dir %q, got %q", "repo", cfg.inv.WorkDir)
+		}
+	})
+
+	t.Run("run dir cleanup", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:   defaultInputSchema,
+			outputSchema:  defaultOutputSchema,
+			workDir:       ".",
+			runDirCleanup: "keep-last",
+			keepRunDirs:   3,
+		}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for keep-last without --work-dir")
+		}
+
+		cmd := newExecCmd()
+		if err := cmd.Flags().Set("work-dir", "runs"); err != nil {
+			t.Fatalf("set work-dir: %v", err)
+		}
+
+		opts.workDir = "runs"
+
+		cfg, err := buildRunConfig(cmd, []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		want := &ainvoke.RunDirPolicy{Cleanup: ainvoke.CleanupKeepLast, KeepLast: 3}
+		if !reflect.DeepEqual(cfg.runDirPolicy, want) {
+			t.Errorf("expected policy %+v, got %+v", want, cfg.runDirPolicy)
+		}
+		if cfg.inv.RunDir != "runs" {
+			t.Errorf("expected run dir base %q, got %q", "runs", cfg.inv.RunDir)
+		}
+
+		opts.workDir = "."
+		opts.runDirCleanup = "on-success"
+
+		cfg, err = buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+		if cfg.inv.RunDir != "" {
+			t.Errorf("expected run dir base to default to the temp dir, got %q", cfg.inv.RunDir)
+		}
+
+		opts.runDirCleanup = "sometimes"
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for unknown cleanup policy")
+		}
+	})
+
+	t.Run("malformed schema", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: `{"type":"object","properties":{"output":{"type":"strin"}}}`,
+			workDir:      ".",
+		}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for malformed output schema")
+		}
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: defaultOutputSchema,
+			workDir:      ".",
+			gracePeriod:  2 * time.Second,
+		}
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+		if cfg.gracePeriod != nil {
+			t.Errorf("expected default grace period, got %v", *cfg.gracePeriod)
+		}
+
+		cmd := newExecCmd()
+		cmd.Flags().Set("grace-period", "2s")
+
+		cfg, err = buildRunConfig(cmd, []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+		if cfg.gracePeriod == nil || *cfg.gracePeriod != 2*time.Second {
+			t.Errorf("expected grace period 2s, got %v", cfg.gracePeriod)
+		}
+	})
+
+	t.Run("resource limits", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:    defaultInputSchema,
+			outputSchema:   defaultOutputSchema,
+			workDir:        ".",
+			cpuLimit:       time.Minute,
+			memoryLimit:    "2GiB",
+			openFilesLimit: 256,
+			processLimit:   64,
+		}
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		want := ainvoke.ResourceLimits{CPUTime: time.Minute, AddressSpace: 2 << 30, OpenFiles: 256, Processes: 64}
+		if cfg.limits != want {
+			t.Errorf("expected limits %+v, got %+v", want, cfg.limits)
+		}
+
+		opts.memoryLimit = "lots"
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for invalid memory limit")
+		}
+	})
+
+	t.Run("sandbox", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:      defaultInputSchema,
+			outputSchema:     defaultOutputSchema,
+			workDir:          ".",
+			sandboxNoNetwork: true,
+			sandboxWritable:  []string{"/var/cache/agent"},
+		}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Fatal("expected error for sandbox flags without --sandbox")
+		}
+
+		opts.sandbox = true
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		if cfg.sandbox == nil || !cfg.sandbox.DisableNetwork || len(cfg.sandbox.WritablePaths) != 1 {
+			t.Errorf("unexpected sandbox %+v", cfg.sandbox)
+		}
+	})
+
+	t.Run("acceptance check", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: defaultOutputSchema,
+			workDir:      ".",
+			checkRetries: 2,
+		}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Fatal("expected error for --check-retries without --check-cmd")
+		}
+
+		opts.checkCmd = "go test ./..."
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		want := &ainvoke.AcceptanceCheck{Cmd: []string{"sh", "-c", "go test ./..."}, Retries: 2}
+		if !reflect.DeepEqual(cfg.check, want) {
+			t.Errorf("expected check %+v, got %+v", want, cfg.check)
+		}
+	})
+
+	t.Run("self check", func(t *testing.T) {
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: defaultOutputSchema,
+			workDir:      ".",
+			selfCheck:    true,
+		}
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		if !strings.HasSuffix(cfg.selfCheck, " check") {
+			t.Errorf("expected a check command, got %q", cfg.selfCheck)
+		}
+
+		opts.outputSource = "stdout"
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for --self-check with --output-source=stdout")
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("AINVOKE_TEST_SECRET", "leak")
+
+		runDir := t.TempDir()
+		opts := &agentOptions{
+			inputSchema:  defaultInputSchema,
+			outputSchema: defaultOutputSchema,
+			workDir:      runDir,
+			env:          []string{"AINVOKE_TEST_KEY=key"},
+			envDeny:      []string{"AINVOKE_TEST_SECRET"},
+		}
+		script := `printf '{"output":"%s%s"}' "$AINVOKE_TEST_KEY" "$AINVOKE_TEST_SECRET" > output.json`
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"sh", "-c", script}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		cfg.inv.Input = map[string]any{"input": "x"}
+
+		res, err := ainvoke.Execute(context.Background(), cfg.runner, cfg.inv)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		if string(res.Output) != `{"output":"key"}` {
+			t.Errorf("unexpected output %s", res.Output)
+		}
+
+		opts.envDeny = []string{"["}
+		if _, err := buildRunConfig(newExecCmd(), []string{"sh"}, opts); err == nil {
+			t.Error("expected error for invalid --env-deny pattern")
+		}
+
+		opts.envDeny = nil
+		opts.env = []string{"NOVALUE"}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"sh"}, opts); err == nil {
+			t.Error("expected error for invalid --env value")
+		}
+	})
+
+	t.Run("prompt template", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "prompt.tmpl")
+		if err := os.WriteFile(path, []byte("{{ .Vars.rules }}: write {{ .OutputPath }}"), 0o644); err != nil {
+			t.Fatalf("write template: %v", err)
+		}
+
+		opts := &agentOptions{
+			inputSchema:    defaultInputSchema,
+			outputSchema:   defaultOutputSchema,
+			workDir:        ".",
+			promptTemplate: path,
+			promptVars:     []string{"rules=house rules"},
+		}
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		if cfg.promptTemplate == nil || cfg.promptVars["rules"] != "house rules" {
+			t.Errorf("unexpected prompt config %v %v", cfg.promptTemplate, cfg.promptVars)
+		}
+
+		if err := os.WriteFile(path, []byte("{{ .OutputPth }}"), 0o644); err != nil {
+			t.Fatalf("write template: %v", err)
+		}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for invalid template")
+		}
+
+		opts.promptTemplate = ""
+		opts.promptVars = []string{"novalue"}
+
+		if _, err := buildRunConfig(newExecCmd(), []string{"test-agent"}, opts); err == nil {
+			t.Error("expected error for invalid --prompt-var")
+		}
+	})
+
+	t.Run("inline input and stdout output", func(t *testing.T) {
+		runDir := t.TempDir()
+		opts := &agentOptions{
+			inputSchema:    defaultInputSchema,
+			outputSchema:   defaultOutputSchema,
+			workDir:        runDir,
+			promptDelivery: "stdin",
+			inlineInput:    true,
+			outputSource:   "stdout",
+		}
+		script := "grep -q '\"input\":\"x\"' && printf '```json\\n{\"output\":\"inline\"}\\n```\\n'"
+
+		cfg, err := buildRunConfig(newExecCmd(), []string{"sh", "-c", script}, opts)
+		if err != nil {
+			t.Fatalf("buildRunConfig failed: %v", err)
+		}
+
+		cfg.inv.Input = map[string]any{"input": "x"}
+
+		res, err := ainvoke.Execute(context.Background(), cfg.runner, cfg.inv)
+		if err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+
+		if string(res.Output) != `{"output":"inline"}` {
+			t.Errorf("unexpected output %s", res.Output)
+		}
+
+		opts.outputSource = "socket"
+		if _, err := buildRunConfig(newExecCmd(), []string{"sh"}, opts); err == nil {
+			t.Error("expected error for invalid --output-source")
+		}
+	})
+
 	t.Run("wrap input", func(t *testing.T) {
 		opts := &agentOptions{
 			inputSchema:  defaultInputSchema,
@@ -206,6 +541,36 @@ func TestBuildRunConfig(t *testing.T) {
 	})
 }
 
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    uint64
+		wantErr bool
+	}{
+		{raw: "", want: 0},
+		{raw: "1024", want: 1024},
+		{raw: "512K", want: 512 << 10},
+		{raw: "512MiB", want: 512 << 20},
+		{raw: "4gb", want: 4 << 30},
+		{raw: "1T", want: 1 << 40},
+		{raw: "many", wantErr: true},
+		{raw: "-1M", wantErr: true},
+		{raw: "99999999999T", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseByteSize(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
 func TestAddModelFlagRequired(t *testing.T) {
 	opts := &agentOptions{}
 	cmd := &cobra.Command{
@@ -415,6 +780,59 @@ func TestRunAndEmitWithTTYDebugAndTimeout(t *testing.T) {
 	}
 }
 
+func TestRunAndEmitRunOptions(t *testing.T) {
+	gracePeriod := time.Second
+
+	promptTemplate, err := ainvoke.NewPromptTemplate(ainvoke.DefaultPromptTemplate)
+	if err != nil {
+		t.Fatalf("new prompt template: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  runConfig
+	}{
+		{name: "repair attempts", cfg: runConfig{repairAttempts: 2}},
+		{name: "idle timeout", cfg: runConfig{idleTimeout: time.Minute}},
+		{name: "grace period", cfg: runConfig{gracePeriod: &gracePeriod}},
+		{name: "early exit", cfg: runConfig{earlyExit: true}},
+		{name: "lenient", cfg: runConfig{lenient: true}},
+		{name: "strict schema", cfg: runConfig{strictSchema: true}},
+		{name: "self check", cfg: runConfig{selfCheck: "ainvoke check"}},
+		{name: "acceptance check", cfg: runConfig{check: &ainvoke.AcceptanceCheck{Cmd: []string{"true"}}}},
+		{name: "resource limits", cfg: runConfig{limits: ainvoke.ResourceLimits{OpenFiles: 64}}},
+		{name: "sandbox", cfg: runConfig{sandbox: &ainvoke.Sandbox{}}},
+		{name: "prompt template", cfg: runConfig{promptTemplate: promptTemplate}},
+		{name: "prompt vars", cfg: runConfig{promptVars: map[string]any{"rules": "x"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, ainvoke.OutputFileName), []byte(`{"output":"ok"}`), 0o644); err != nil {
+				t.Fatalf("write output: %v", err)
+			}
+
+			runner := &captureRunner{}
+			cfg := tt.cfg
+			cfg.runDir = tmpDir
+			cfg.runner = runner
+
+			_, restore := captureFile(t, &os.Stdout)
+			defer restore()
+
+			if err := runAndEmit(context.Background(), cfg); err != nil {
+				t.Fatalf("runAndEmit: %v", err)
+			}
+
+			restore()
+			if runner.gotRunOpts != 1 {
+				t.Fatalf("expected 1 run opt, got %d", runner.gotRunOpts)
+			}
+		})
+	}
+}
+
 type fakeRunner struct {
 	outBytes []byte
 	errBytes []byte
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/metalagman/ainvoke"
+	"github.com/spf13/cobra"
+)
+
+func newCodexCmd() *cobra.Command { return newWrapperCmd(ainvoke.CodexAdapter) }
+
+func newClaudeCmd() *cobra.Command { return newWrapperCmd(ainvoke.ClaudeAdapter) }
+
+func newGeminiCmd() *cobra.Command { return newWrapperCmd(ainvoke.GeminiAdapter) }
+
+func newOpenCodeCmd() *cobra.Command { return newWrapperCmd(ainvoke.OpenCodeAdapter) }
+
+// newWrapperCmd returns the command running the CLI of adapter, with the
+// flags and prompt delivery it needs.
+func newWrapperCmd(adapter ainvoke.Adapter) *cobra.Command {
+	opts := &agentOptions{}
+	cmd := &cobra.Command{
+		Use:   adapter.Name(),
+		Short: "Invoke " + adapter.Name() + " with normalized JSON I/O",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			agentCfg := adapter.Config(ainvoke.AdapterOptions{Model: opts.model, ExtraArgs: opts.extraArgs})
+			opts.useTTY = agentCfg.UseTTY
+
+			return runAgent(cmd, agentCfg.Cmd, opts)
+		},
+	}
+
+	addCommonFlags(cmd, opts, false)
+
+	if delivery := adapter.Config(ainvoke.AdapterOptions{}).PromptDelivery; delivery != "" {
+		setPromptDelivery(cmd, opts, delivery)
+	}
+
+	if err := addModelFlag(cmd, opts, false); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+// setPromptDelivery changes the default of --prompt-delivery to the mode the
+// wrapped CLI expects.
+func setPromptDelivery(cmd *cobra.Command, opts *agentOptions, delivery ainvoke.PromptDelivery) {
+	opts.promptDelivery = string(delivery)
+	cmd.Flags().Lookup("prompt-delivery").DefValue = string(delivery)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/metalagman/ainvoke"
+	"github.com/spf13/cobra"
+)
+
+func TestWrapperPromptDelivery(t *testing.T) {
+	tests := []struct {
+		cmd  *cobra.Command
+		want ainvoke.PromptDelivery
+	}{
+		{cmd: newExecCmd(), want: ainvoke.PromptStdin},
+		{cmd: newClaudeCmd(), want: ainvoke.PromptArg},
+		{cmd: newCodexCmd(), want: ainvoke.PromptStdin},
+		{cmd: newGeminiCmd(), want: ainvoke.PromptStdin},
+		{cmd: newOpenCodeCmd(), want: ainvoke.PromptArg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd.Name(), func(t *testing.T) {
+			flag := tt.cmd.Flags().Lookup("prompt-delivery")
+			if flag.DefValue != string(tt.want) || flag.Value.String() != string(tt.want) {
+				t.Errorf("expected prompt delivery %s, got default %s, value %s", tt.want, flag.DefValue, flag.Value)
+			}
+		})
+	}
+
+	opts := &agentOptions{
+		inputSchema:    defaultInputSchema,
+		outputSchema:   defaultOutputSchema,
+		workDir:        ".",
+		promptDelivery: "placeholder",
+	}
+	if _, err := buildRunConfig(newExecCmd(), []string{"agent", "-p"}, opts); err == nil {
+		t.Error("expected error for placeholder delivery without {{prompt}}")
+	}
+}
@@ -0,0 +1,97 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// outputPollInterval is how often output.json is checked for early
+	// completion.
+	outputPollInterval = 100 * time.Millisecond
+	// outputSettleTime is how long output.json must stay unchanged before it is
+	// validated.
+	outputSettleTime = 300 * time.Millisecond
+)
+
+// errOutputReady is the cancellation cause used once the agent has written
+// valid output and can be stopped.
+var errOutputReady = errors.New("output ready")
+
+// watchOutput stops the agent as soon as output.json exists, has stopped
+// changing and passes the output schema. The returned context is canceled
+// with errOutputReady as its cause; stop must be called when the attempt is
+// over. It is a no-op unless enabled.
+func watchOutput(ctx context.Context, inv Invocation, enabled bool) (context.Context, func()) {
+	if !enabled {
+		return ctx, func() {}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		outputPath := filepath.Join(inv.RunDir, OutputFileName)
+
+		ticker := time.NewTicker(outputPollInterval)
+		defer ticker.Stop()
+
+		var (
+			last    os.FileInfo
+			since   time.Time
+			checked bool
+		)
+
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-stopped:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(outputPath)
+			if err != nil || info.Size() == 0 {
+				last = nil
+
+				continue
+			}
+
+			if last == nil || info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime()) {
+				last, since, checked = info, time.Now(), false
+
+				continue
+			}
+
+			if checked || time.Since(since) < outputSettleTime {
+				continue
+			}
+
+			checked = true
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				continue
+			}
+
+			if inv.validateOutput(data) == nil {
+				cancel(errOutputReady)
+
+				return
+			}
+		}
+	}()
+
+	return runCtx, func() {
+		close(stopped)
+		<-finished
+		cancel(nil)
+	}
+}
@@ -0,0 +1,65 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRunEarlyCompletion(t *testing.T) {
+	for _, tty := range []bool{false, true} {
+		t.Run("tty="+strconv.FormatBool(tty), func(t *testing.T) {
+			runner := newShellRunner(t, `printf '{"result":"ok"}' > output.json; sleep 30`)
+
+			start := time.Now()
+
+			res, err := runner.Execute(
+				context.Background(),
+				helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+				WithTTY(tty),
+				WithEarlyCompletion(true),
+			)
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			if !res.EarlyCompletion {
+				t.Error("expected early completion to be reported")
+			}
+			if string(res.Output) != `{"result":"ok"}` {
+				t.Errorf("unexpected output %q", res.Output)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("expected agent to be stopped early, took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestRunEarlyCompletionWaitsForValidOutput(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"result":1}' > output.json; sleep 1; printf '{"result":"ok"}' > output.json; sleep 30`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	res, err := runner.Execute(ctx, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}), WithEarlyCompletion(true))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Errorf("expected the corrected output, got %q", res.Output)
+	}
+}
+
+func TestRunEarlyCompletionDisabled(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"result":"ok"}' > output.json; sleep 30`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := runner.Execute(ctx, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}), WithGracePeriod(0))
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout without early completion, got %v", err)
+	}
+}
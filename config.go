@@ -4,4 +4,26 @@ package ainvoke
 type AgentConfig struct {
 	Cmd    []string `json:"cmd,omitempty"     mapstructure:"cmd"`
 	UseTTY bool     `json:"use_tty,omitempty" mapstructure:"use_tty"`
+	// PromptDelivery selects how the prompt reaches the agent; empty means
+	// PromptStdin.
+	PromptDelivery PromptDelivery `json:"prompt_delivery,omitempty" mapstructure:"prompt_delivery"`
+	// InlineInput embeds the input JSON in the prompt for agents that cannot
+	// read files. input.json is still written to the run directory.
+	InlineInput bool `json:"inline_input,omitempty" mapstructure:"inline_input"`
+	// OutputSource selects where the output is taken from; empty means
+	// OutputSourceFile.
+	OutputSource OutputSource `json:"output_source,omitempty" mapstructure:"output_source"`
+	// Env sets variables for the agent, overriding inherited ones.
+	Env map[string]string `json:"env,omitempty" mapstructure:"env"`
+	// EnvAllow, when not empty, limits the inherited variables to those
+	// matching one of its names or globs (e.g. "AWS_*").
+	EnvAllow []string `json:"env_allow,omitempty" mapstructure:"env_allow"`
+	// EnvDeny removes inherited variables matching one of its names or globs.
+	EnvDeny []string `json:"env_deny,omitempty" mapstructure:"env_deny"`
+	// CleanEnv starts the agent with no inherited variables, only Env.
+	CleanEnv bool `json:"clean_env,omitempty" mapstructure:"clean_env"`
+	// InputSchema and OutputSchema are used by invocations that leave their
+	// schema empty. NewRunner compiles them and rejects malformed ones.
+	InputSchema  string `json:"input_schema,omitempty"  mapstructure:"input_schema"`
+	OutputSchema string `json:"output_schema,omitempty" mapstructure:"output_schema"`
 }
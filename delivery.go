@@ -0,0 +1,84 @@
+package ainvoke
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PromptDelivery selects how the rendered prompt reaches the agent.
+type PromptDelivery string
+
+const (
+	// PromptStdin writes the prompt to stdin, or types it into the terminal
+	// followed by Ctrl-D in TTY mode. It is the default.
+	PromptStdin PromptDelivery = "stdin"
+	// PromptArg appends the prompt to the command as its last argument.
+	PromptArg PromptDelivery = "arg"
+	// PromptPlaceholder replaces PromptPlaceholderArg in the command
+	// arguments with the prompt, e.g. []string{"agent", "--message={{prompt}}"}.
+	PromptPlaceholder PromptDelivery = "placeholder"
+	// PromptFile writes the prompt to prompt.md in the run directory and
+	// replaces PromptFilePlaceholderArg in the command arguments with its
+	// absolute path, or appends the path when there is no placeholder.
+	PromptFile PromptDelivery = "file"
+)
+
+// Placeholders substituted in the command arguments by PromptPlaceholder and
+// PromptFile.
+const (
+	PromptPlaceholderArg     = "{{prompt}}"
+	PromptFilePlaceholderArg = "{{prompt_file}}"
+)
+
+func (d PromptDelivery) validate(cmd []string) error {
+	switch d {
+	case "", PromptStdin, PromptArg, PromptFile:
+		return nil
+	case PromptPlaceholder:
+		if !slices.ContainsFunc(cmd[1:], func(arg string) bool { return strings.Contains(arg, PromptPlaceholderArg) }) {
+			return fmt.Errorf("prompt delivery %q needs a %s argument", d, PromptPlaceholderArg)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown prompt delivery %q (want stdin, arg, placeholder or file)", d)
+	}
+}
+
+// deliverPrompt returns the command line and stdin that hand prompt to the
+// agent.
+func (r *ExecRunner) deliverPrompt(runDir, prompt string) (argv []string, stdin []byte, err error) {
+	argv = append([]string(nil), r.cmd...)
+
+	switch r.promptDelivery {
+	case PromptArg:
+		return append(argv, prompt), nil, nil
+	case PromptPlaceholder:
+		return replaceArgs(argv, PromptPlaceholderArg, prompt), nil, nil
+	case PromptFile:
+		path := filepath.Join(runDir, PromptFileName)
+		if err := os.WriteFile(path, []byte(prompt), inputFilePerm); err != nil {
+			return nil, nil, fmt.Errorf("write %s: %w", path, err)
+		}
+
+		if !slices.ContainsFunc(argv[1:], func(arg string) bool { return strings.Contains(arg, PromptFilePlaceholderArg) }) {
+			return append(argv, path), nil, nil
+		}
+
+		return replaceArgs(argv, PromptFilePlaceholderArg, path), nil, nil
+	default:
+		return argv, []byte(prompt), nil
+	}
+}
+
+// replaceArgs replaces placeholder in every argument but the command name.
+func replaceArgs(argv []string, placeholder, value string) []string {
+	for i := 1; i < len(argv); i++ {
+		argv[i] = strings.ReplaceAll(argv[i], placeholder, value)
+	}
+
+	return argv
+}
@@ -0,0 +1,110 @@
+package ainvoke
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunPromptDelivery(t *testing.T) {
+	const save = `printf '%s' "$1" > arg.txt; cat > stdin.txt; printf '{"result":"ok"}' > output.json`
+
+	tests := []struct {
+		name      string
+		cmd       []string
+		delivery  PromptDelivery
+		wantArg   string
+		wantStdin bool
+	}{
+		{name: "stdin", cmd: []string{"sh", "-c", save, "sh"}, delivery: PromptStdin, wantStdin: true},
+		{name: "default", cmd: []string{"sh", "-c", save, "sh"}, wantStdin: true},
+		{name: "arg", cmd: []string{"sh", "-c", save, "sh"}, delivery: PromptArg, wantArg: "{prompt}"},
+		{
+			name:     "placeholder",
+			cmd:      []string{"sh", "-c", save, "sh", "--message={{prompt}}"},
+			delivery: PromptPlaceholder,
+			wantArg:  "--message={prompt}",
+		},
+		{name: "file", cmd: []string{"sh", "-c", save, "sh"}, delivery: PromptFile, wantArg: "{prompt_file}"},
+		{
+			name:     "file placeholder",
+			cmd:      []string{"sh", "-c", save, "sh", "--prompt-file={{prompt_file}}"},
+			delivery: PromptFile,
+			wantArg:  "--prompt-file={prompt_file}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runDir := t.TempDir()
+
+			runner, err := NewRunner(AgentConfig{Cmd: tt.cmd, PromptDelivery: tt.delivery})
+			if err != nil {
+				t.Fatalf("new runner: %v", err)
+			}
+
+			res, err := runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}))
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			promptFile := filepath.Join(runDir, PromptFileName)
+			wantArg := strings.NewReplacer("{prompt}", res.Prompt, "{prompt_file}", promptFile).Replace(tt.wantArg)
+
+			if got := readTrimmed(t, filepath.Join(runDir, "arg.txt")); got != strings.TrimSpace(wantArg) {
+				t.Errorf("expected argument %q, got %q", wantArg, got)
+			}
+
+			gotStdin := readTrimmed(t, filepath.Join(runDir, "stdin.txt"))
+			if tt.wantStdin != (gotStdin == strings.TrimSpace(res.Prompt)) || (!tt.wantStdin && gotStdin != "") {
+				t.Errorf("unexpected stdin %q", gotStdin)
+			}
+
+			if tt.delivery == PromptFile && readTrimmed(t, promptFile) != strings.TrimSpace(res.Prompt) {
+				t.Errorf("expected prompt in %s", promptFile)
+			}
+
+			if wantArg != "" && !slices.Contains(res.Argv, wantArg) {
+				t.Errorf("expected %q in argv %q", wantArg, res.Argv)
+			}
+		})
+	}
+}
+
+func TestRunPromptDeliveryWithTTY(t *testing.T) {
+	runDir := t.TempDir()
+
+	runner, err := NewRunner(AgentConfig{
+		Cmd:            []string{"sh", "-c", `printf '%s' "$1" > arg.txt; printf '{"result":"ok"}' > output.json`, "sh"},
+		UseTTY:         true,
+		PromptDelivery: PromptArg,
+	})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	res, err := runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if got := readTrimmed(t, filepath.Join(runDir, "arg.txt")); got != strings.TrimSpace(res.Prompt) {
+		t.Errorf("expected prompt as argument, got %q", got)
+	}
+}
+
+func TestPromptDeliveryValidation(t *testing.T) {
+	if _, err := NewRunner(AgentConfig{Cmd: []string{"agent"}, PromptDelivery: "mail"}); err == nil {
+		t.Error("expected error for unknown delivery")
+	}
+
+	if _, err := NewRunner(AgentConfig{Cmd: []string{"agent", "-p"}, PromptDelivery: PromptPlaceholder}); err == nil {
+		t.Error("expected error for placeholder delivery without a placeholder")
+	}
+
+	if _, err := NewRunner(AgentConfig{Cmd: []string{"agent", "-p={{prompt}}"}, PromptDelivery: PromptPlaceholder}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
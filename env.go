@@ -0,0 +1,82 @@
+package ainvoke
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// agentEnv builds the environment of the agent process from the parent
+// environment. CleanEnv drops every inherited variable; otherwise an allowlist
+// keeps only matching variables and a denylist removes matching ones. The
+// variables set explicitly are applied next, and the contract variables
+// describing the run last, so they cannot be overridden.
+func agentEnv(parent []string, opts RunOptions, contract map[string]string) []string {
+	set := maps.Clone(opts.env)
+	if set == nil {
+		set = make(map[string]string, len(contract))
+	}
+
+	maps.Copy(set, contract)
+
+	env := make([]string, 0, len(parent)+len(set))
+
+	if !opts.cleanEnv {
+		for _, kv := range parent {
+			name, _, _ := strings.Cut(kv, "=")
+			if _, ok := set[name]; ok {
+				continue
+			}
+
+			if len(opts.envAllow) > 0 && !matchEnvName(opts.envAllow, name) {
+				continue
+			}
+
+			if matchEnvName(opts.envDeny, name) {
+				continue
+			}
+
+			env = append(env, kv)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(set)) {
+		env = append(env, name+"="+set[name])
+	}
+
+	return env
+}
+
+// matchEnvName reports whether name matches one of patterns. Patterns are
+// variable names or path.Match globs such as AWS_*.
+func matchEnvName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateEnv(env map[string]string, allow, deny []string) error {
+	for name, value := range env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("variable %s contains a NUL byte", name)
+		}
+	}
+
+	for _, pattern := range slices.Concat(allow, deny) {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid variable pattern %q", pattern)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package ainvoke
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAgentEnv(t *testing.T) {
+	parent := []string{"PATH=/bin", "HOME=/root", "AWS_SECRET=s", "AWS_REGION=eu", "TOKEN=t"}
+
+	tests := []struct {
+		name string
+		opts []RunOption
+		want []string
+	}{
+		{name: "inherit", want: parent},
+		{
+			name: "set overrides",
+			opts: []RunOption{WithEnv(map[string]string{"TOKEN": "new", "API_KEY": "k"})},
+			want: []string{"PATH=/bin", "HOME=/root", "AWS_SECRET=s", "AWS_REGION=eu", "API_KEY=k", "TOKEN=new"},
+		},
+		{
+			name: "allow",
+			opts: []RunOption{WithEnvAllow("PATH", "AWS_*")},
+			want: []string{"PATH=/bin", "AWS_SECRET=s", "AWS_REGION=eu"},
+		},
+		{
+			name: "allow and deny",
+			opts: []RunOption{WithEnvAllow("PATH", "AWS_*"), WithEnvDeny("*SECRET*")},
+			want: []string{"PATH=/bin", "AWS_REGION=eu"},
+		},
+		{
+			name: "clean",
+			opts: []RunOption{WithCleanEnv(true), WithEnv(map[string]string{"PATH": "/usr/bin"})},
+			want: []string{"PATH=/usr/bin"},
+		},
+		{
+			name: "clean without variables",
+			opts: []RunOption{WithCleanEnv(true)},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := resolveRunOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("resolve options: %v", err)
+			}
+
+			got := agentEnv(parent, opts, nil)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAgentEnvContract(t *testing.T) {
+	parent := []string{"PATH=/bin", "AINVOKE_RUN_ID=outer"}
+
+	opts, err := resolveRunOptions([]RunOption{
+		WithCleanEnv(true),
+		WithEnv(map[string]string{"AINVOKE_RUN_DIR": "/mine"}),
+	})
+	if err != nil {
+		t.Fatalf("resolve options: %v", err)
+	}
+
+	got := agentEnv(parent, opts, map[string]string{EnvRunID: "inner", EnvRunDir: "/run"})
+	want := []string{"AINVOKE_RUN_DIR=/run", "AINVOKE_RUN_ID=inner"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEnvValidation(t *testing.T) {
+	for _, opt := range []RunOption{
+		WithEnv(map[string]string{"A=B": "x"}),
+		WithEnv(map[string]string{"": "x"}),
+		WithEnvAllow("["),
+		WithEnvDeny(""),
+	} {
+		if _, err := resolveRunOptions([]RunOption{opt}); err == nil {
+			t.Error("expected validation error")
+		}
+	}
+
+	if _, err := NewRunner(AgentConfig{Cmd: []string{"true"}, EnvDeny: []string{"["}}); err == nil {
+		t.Error("expected NewRunner to reject an invalid pattern")
+	}
+}
+
+func TestRunEnv(t *testing.T) {
+	t.Setenv("AINVOKE_TEST_SECRET", "leak")
+	t.Setenv("AINVOKE_TEST_KEPT", "kept")
+
+	runDir := t.TempDir()
+
+	runner, err := NewRunner(AgentConfig{
+		Cmd: []string{"sh", "-c", `env > env.txt; printf '{"result":"ok"}' > output.json`},
+		Env: map[string]string{"AINVOKE_TEST_CONFIG": "config"},
+	})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	for _, tty := range []bool{false, true} {
+		_, err := runner.Execute(
+			context.Background(),
+			helloInvocation(runDir, map[string]any{"name": "Ada"}),
+			WithTTY(tty),
+			WithEnvDeny("AINVOKE_TEST_SECRET"),
+			WithEnv(map[string]string{"AINVOKE_TEST_OPTION": "option"}),
+		)
+		if err != nil {
+			t.Fatalf("execute (tty=%v): %v", tty, err)
+		}
+
+		env := readTrimmed(t, filepath.Join(runDir, "env.txt"))
+		for _, want := range []string{"AINVOKE_TEST_KEPT=kept", "AINVOKE_TEST_CONFIG=config", "AINVOKE_TEST_OPTION=option"} {
+			if !strings.Contains(env, want) {
+				t.Errorf("expected %s in agent env (tty=%v)", want, tty)
+			}
+		}
+
+		if strings.Contains(env, "AINVOKE_TEST_SECRET") {
+			t.Errorf("expected denied variable to be removed (tty=%v)", tty)
+		}
+	}
+}
+
+func TestRunCleanEnvWithInit(t *testing.T) {
+	t.Setenv("AINVOKE_TEST_SECRET", "leak")
+
+	runDir := t.TempDir()
+	runner := newShellRunner(t, `env > env.txt; printf '{"result":"ok"}' > output.json`)
+
+	_, err := runner.Execute(
+		context.Background(),
+		helloInvocation(runDir, map[string]any{"name": "Ada"}),
+		WithCleanEnv(true),
+		WithEnv(map[string]string{"PATH": "/usr/bin:/bin"}),
+		WithResourceLimits(ResourceLimits{OpenFiles: 64}),
+	)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if env := readTrimmed(t, filepath.Join(runDir, "env.txt")); strings.Contains(env, "AINVOKE_TEST_SECRET") {
+		t.Errorf("expected a clean environment, got %s", env)
+	}
+}
@@ -1,10 +1,17 @@
 package ainvoke
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
 
 var (
 	// ErrMissingRunDir indicates RunDir does not exist.
 	ErrMissingRunDir = errors.New("run dir missing")
+	// ErrMissingWorkDir indicates WorkDir does not exist.
+	ErrMissingWorkDir = errors.New("work dir missing")
 	// ErrMissingInput indicates input.json is required but missing.
 	ErrMissingInput = errors.New("input file missing")
 	// ErrInputSchemaEmpty indicates an empty input schema was provided.
@@ -13,10 +20,180 @@ var (
 	ErrInputSchemaInvalid = errors.New("input does not match schema")
 	// ErrRunFailed indicates the agent exited with a non-zero code.
 	ErrRunFailed = errors.New("agent run failed")
+	// ErrTimeout indicates the agent was stopped because the context deadline
+	// passed.
+	ErrTimeout = errors.New("agent timed out")
+	// ErrIdleTimeout indicates the agent was stopped because it produced no
+	// output and changed no file in the run directory for the idle timeout.
+	ErrIdleTimeout = errors.New("agent idle timeout")
+	// ErrCanceled indicates the agent was stopped because the context was
+	// canceled.
+	ErrCanceled = errors.New("agent run canceled")
 	// ErrMissingOutput indicates output.json was not produced.
 	ErrMissingOutput = errors.New("output file missing")
 	// ErrOutputSchemaEmpty indicates an empty output schema was provided.
 	ErrOutputSchemaEmpty = errors.New("output schema is empty")
 	// ErrOutputSchemaInvalid indicates output.json does not satisfy the schema.
 	ErrOutputSchemaInvalid = errors.New("output does not match schema")
+	// ErrOutputRejected indicates output.json matches the schema but a
+	// Validator set with WithValidators rejected it.
+	ErrOutputRejected = errors.New("output rejected by validator")
+	// ErrCheckFailed indicates the acceptance check set with
+	// WithAcceptanceCheck still failed after its retries.
+	ErrCheckFailed = errors.New("acceptance check failed")
+	// ErrUnknownFormat indicates a strict schema uses a format no checker is
+	// registered for.
+	ErrUnknownFormat = errors.New("unknown schema format")
+	// ErrUnknownAdapter indicates no adapter is registered under a name.
+	ErrUnknownAdapter = errors.New("unknown agent adapter")
+)
+
+// Phase identifies the stage of a run an error belongs to.
+type Phase int
+
+const (
+	// PhaseInputValidation covers reading and validating input.json.
+	PhaseInputValidation Phase = iota + 1
+	// PhaseProcessStart covers starting the agent process.
+	PhaseProcessStart
+	// PhaseProcessExit covers an agent that exited with a non-zero code or was
+	// stopped by a timeout, an idle timeout or a cancellation.
+	PhaseProcessExit
+	// PhaseOutputMissing covers an agent that did not write output.json.
+	PhaseOutputMissing
+	// PhaseOutputValidation covers reading and validating output.json.
+	PhaseOutputValidation
+	// PhaseAcceptanceCheck covers the acceptance check run after valid output.
+	PhaseAcceptanceCheck
 )
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseInputValidation:
+		return "input validation"
+	case PhaseProcessStart:
+		return "process start"
+	case PhaseProcessExit:
+		return "process exit"
+	case PhaseOutputMissing:
+		return "output missing"
+	case PhaseOutputValidation:
+		return "output validation"
+	case PhaseAcceptanceCheck:
+		return "acceptance check"
+	default:
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+}
+
+// RunError describes a failed run. It wraps the underlying error, so the
+// sentinels above still match with errors.Is.
+type RunError struct {
+	// Phase is the stage the run failed in.
+	Phase Phase
+	// ExitCode is the agent exit code, or 0 if the agent did not run or exit.
+	ExitCode int
+	// StderrTail is the end of the captured stderr, or of stdout when the agent
+	// wrote nothing to stderr.
+	StderrTail string
+	// Failures lists the schema violations for the validation phases.
+	Failures []ValidationFailure
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *RunError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// stderrTailSize bounds RunError.StderrTail.
+const stderrTailSize = 4 << 10
+
+// newRunError wraps err with its phase, the exit code and diagnostics captured
+// in res, which may be nil, and the failures of a wrapped ValidationError.
+func newRunError(phase Phase, res *Result, err error) *RunError {
+	runErr := &RunError{Phase: phase, Err: err}
+
+	if res != nil {
+		runErr.ExitCode = res.ExitCode
+		runErr.StderrTail = tail(res.Diagnostics(), stderrTailSize)
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		runErr.Failures = validationErr.Failures
+	}
+
+	return runErr
+}
+
+// outputPhase returns the phase of an error found while processing output.json.
+func outputPhase(err error) Phase {
+	if errors.Is(err, ErrMissingOutput) {
+		return PhaseOutputMissing
+	}
+
+	return PhaseOutputValidation
+}
+
+// tail returns at most the last n bytes of data, starting at a rune boundary.
+func tail(data []byte, n int) string {
+	if len(data) <= n {
+		return string(data)
+	}
+
+	data = data[len(data)-n:]
+	for len(data) > 0 && !utf8.RuneStart(data[0]) {
+		data = data[1:]
+	}
+
+	return string(data)
+}
+
+// ValidationFailure is a single schema violation.
+type ValidationFailure struct {
+	// Pointer is the RFC 6901 JSON pointer of the offending value; "" is the
+	// document root. For a missing required property it points at the property.
+	Pointer string
+	// Keyword is the schema keyword that failed, such as "type" or "required",
+	// or the name of the Validator that reported the failure. It is empty
+	// when the document is not valid JSON.
+	Keyword string
+	// Message describes the violation.
+	Message string
+}
+
+func (f ValidationFailure) String() string {
+	pointer := f.Pointer
+	if pointer == "" {
+		pointer = "(root)"
+	}
+
+	return pointer + ": " + f.Message
+}
+
+// ValidationError reports every schema violation found in a document. It
+// unwraps to ErrInputSchemaInvalid or ErrOutputSchemaInvalid, or to
+// ErrOutputRejected for failures reported by a Validator.
+type ValidationError struct {
+	Failures []ValidationFailure
+
+	sentinel error
+}
+
+func (e *ValidationError) Error() string {
+	details := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		details = append(details, f.String())
+	}
+
+	return fmt.Sprintf("%s: %s", e.sentinel, strings.Join(details, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.sentinel
+}
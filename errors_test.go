@@ -0,0 +1,156 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunErrorPhases(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      []string
+		input    any
+		phase    Phase
+		exitCode int
+		tail     string
+		failures []ValidationFailure
+		sentinel error
+	}{
+		{
+			name:     "input validation",
+			cmd:      []string{"true"},
+			input:    map[string]any{"name": 1},
+			phase:    PhaseInputValidation,
+			failures: []ValidationFailure{{Pointer: "/name", Keyword: "type", Message: "Invalid type. Expected: string, given: integer"}},
+			sentinel: ErrInputSchemaInvalid,
+		},
+		{
+			name:  "process start",
+			cmd:   []string{"ainvoke-test-missing-binary"},
+			phase: PhaseProcessStart,
+		},
+		{
+			name:     "process exit",
+			cmd:      []string{"sh", "-c", "echo boom >&2; exit 3"},
+			phase:    PhaseProcessExit,
+			exitCode: 3,
+			tail:     "boom\n",
+			sentinel: ErrRunFailed,
+		},
+		{
+			name:     "output missing",
+			cmd:      []string{"sh", "-c", "echo nothing"},
+			phase:    PhaseOutputMissing,
+			tail:     "nothing\n",
+			sentinel: ErrMissingOutput,
+		},
+		{
+			name:     "output validation",
+			cmd:      []string{"sh", "-c", `printf '{"extra":true}' > output.json`},
+			phase:    PhaseOutputValidation,
+			failures: []ValidationFailure{{Pointer: "/result", Keyword: "required", Message: "result is required"}},
+			sentinel: ErrOutputSchemaInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(AgentConfig{Cmd: tt.cmd})
+			if err != nil {
+				t.Fatalf("new runner: %v", err)
+			}
+
+			input := tt.input
+			if input == nil {
+				input = map[string]any{"name": "Ada"}
+			}
+
+			_, err = runner.Execute(context.Background(), helloInvocation(t.TempDir(), input))
+
+			var runErr *RunError
+			if !errors.As(err, &runErr) {
+				t.Fatalf("expected RunError, got %v", err)
+			}
+			if runErr.Phase != tt.phase {
+				t.Errorf("expected phase %s, got %s", tt.phase, runErr.Phase)
+			}
+			if runErr.ExitCode != tt.exitCode {
+				t.Errorf("expected exit code %d, got %d", tt.exitCode, runErr.ExitCode)
+			}
+			if runErr.StderrTail != tt.tail {
+				t.Errorf("expected stderr tail %q, got %q", tt.tail, runErr.StderrTail)
+			}
+			if !reflect.DeepEqual(runErr.Failures, tt.failures) {
+				t.Errorf("expected failures %+v, got %+v", tt.failures, runErr.Failures)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("expected %v, got %v", tt.sentinel, err)
+			}
+		})
+	}
+}
+
+func TestValidationErrorPointers(t *testing.T) {
+	schema := `{
+  "type":"object",
+  "properties":{
+    "items":{"type":"array","items":{"type":"object","properties":{"a/b~c":{"type":"integer"}}}}
+  },
+  "additionalProperties":false
+}`
+
+	err := validateOutput(schema, []byte(`{"items":[{"a/b~c":1},{"a/b~c":"x"}],"other":1}`))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+
+	got := map[string]string{}
+	for _, f := range validationErr.Failures {
+		got[f.Pointer] = f.Keyword
+	}
+
+	want := map[string]string{
+		"/items/1/a~1b~0c": "type",
+		"/other":           "additionalProperties",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestValidationErrorInvalidJSON(t *testing.T) {
+	err := validateOutput(helloOutputSchema, []byte(`not json`))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(validationErr.Failures) != 1 {
+		t.Fatalf("expected a single failure, got %+v", validationErr.Failures)
+	}
+
+	f := validationErr.Failures[0]
+	if f.Pointer != "" || f.Keyword != "" || !strings.HasPrefix(f.Message, "invalid JSON") {
+		t.Fatalf("unexpected failure %+v", f)
+	}
+}
+
+func TestTail(t *testing.T) {
+	if got := tail([]byte("short"), 10); got != "short" {
+		t.Fatalf("expected short input unchanged, got %q", got)
+	}
+	if got := tail([]byte("abcdef"), 3); got != "def" {
+		t.Fatalf("expected last bytes, got %q", got)
+	}
+	if got := tail([]byte("aé"), 1); got != "" {
+		t.Fatalf("expected partial rune to be dropped, got %q", got)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package ainvoke
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// MaybeRunInit must be called at the start of main by programs that use
+// WithResourceLimits or WithSandbox. Neither is supported on this platform,
+// so it does nothing.
+func MaybeRunInit() {}
+
+func wrapInit(_ *exec.Cmd, proc processOptions) error {
+	if !proc.limits.isZero() {
+		return errors.New("resource limits are only supported on unix")
+	}
+
+	if proc.sandbox != nil {
+		return errors.New("sandbox is only supported on Linux")
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// initArg0 marks a re-executed copy of the host binary whose only job is to
+// prepare the process and exec the agent. Work that must happen between fork
+// and exec, such as setting resource limits or mounting the sandbox, is done
+// there, so no process spawned by the agent can escape it.
+const initArg0 = "ainvoke-init"
+
+// initEnabled is set by MaybeRunInit, so runs only re-execute binaries that
+// are known to handle initArg0.
+var initEnabled atomic.Bool
+
+// MaybeRunInit must be called at the start of main by programs that use
+// WithResourceLimits or WithSandbox. Those options start the agent through a
+// copy of the running binary with argv[0] set to "ainvoke-init"; in that copy
+// MaybeRunInit applies the settings and execs the agent, and never returns.
+// Otherwise it returns at once. Without the call, runs using those options
+// fail at process start.
+func MaybeRunInit() {
+	initEnabled.Store(true)
+
+	if len(os.Args) > 0 && os.Args[0] == initArg0 {
+		if err := runInit(os.Args[1:]); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", initArg0, err)
+		}
+
+		os.Exit(127)
+	}
+}
+
+// wrapInit makes cmd start through the init when proc needs it. The init
+// receives its options as key=value arguments, then "--", the agent path and
+// its argv.
+func wrapInit(cmd *exec.Cmd, proc processOptions) error {
+	args := rlimitArgs(proc.limits)
+
+	if proc.sandbox != nil {
+		sandboxArgs, err := configureSandbox(cmd, *proc.sandbox, proc.writable)
+		if err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+
+		args = append(args, sandboxArgs...)
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	if !initEnabled.Load() {
+		return errors.New("resource limits and the sandbox need ainvoke.MaybeRunInit() at the start of main")
+	}
+
+	self, err := selfExecutable()
+	if err != nil {
+		return fmt.Errorf("locate executable: %w", err)
+	}
+
+	cmd.Args = append(append(append([]string{initArg0}, args...), "--", cmd.Path), cmd.Args...)
+	cmd.Path = self
+
+	return nil
+}
+
+// selfExecutable returns a path to the running binary. /proc/self/exe still
+// refers to it after the file was replaced or deleted, as during a deploy.
+func selfExecutable() (string, error) {
+	if _, err := os.Stat("/proc/self/exe"); err == nil {
+		return "/proc/self/exe", nil
+	}
+
+	return os.Executable()
+}
+
+func runInit(args []string) error {
+	var (
+		rlimits []string
+		sandbox sandboxSetup
+	)
+
+	for len(args) > 0 && args[0] != "--" {
+		key, value, _ := strings.Cut(args[0], "=")
+
+		switch key {
+		case "rlimit":
+			rlimits = append(rlimits, value)
+		case "sandbox":
+			sandbox.enabled = true
+		case "writable":
+			sandbox.writable = append(sandbox.writable, value)
+		default:
+			return fmt.Errorf("unknown option %q", args[0])
+		}
+
+		args = args[1:]
+	}
+
+	if len(args) < 3 {
+		return fmt.Errorf("missing agent command")
+	}
+
+	if sandbox.enabled {
+		if err := sandbox.setup(); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+
+	// Limits come last so a low open file limit cannot break the setup.
+	for _, rlimit := range rlimits {
+		if err := setRlimit(rlimit); err != nil {
+			return err
+		}
+	}
+
+	path, argv := args[1], args[2:]
+
+	return syscall.Exec(path, argv, os.Environ())
+}
@@ -6,3 +6,31 @@ const InputFileName = "input.json"
 // OutputFileName is the name of the file containing the output JSON data.
 const OutputFileName = "output.json"
 
+// PromptFileName is the name of the file the prompt is written to with
+// PromptFile delivery.
+const PromptFileName = "prompt.md"
+
+// InputSchemaFileName and OutputSchemaFileName are the names of the files the
+// input and output schemas are written to, next to input.json.
+const (
+	InputSchemaFileName  = "input.schema.json"
+	OutputSchemaFileName = "output.schema.json"
+)
+
+// Environment variables exported to every agent. They let an agent find its
+// files without parsing the prompt.
+const (
+	// EnvRunID is a random identifier unique to each Execute call.
+	EnvRunID = "AINVOKE_RUN_ID"
+	// EnvRunDir is the absolute run directory.
+	EnvRunDir = "AINVOKE_RUN_DIR"
+	// EnvInputPath is the absolute path of input.json.
+	EnvInputPath = "AINVOKE_INPUT_PATH"
+	// EnvOutputPath is the absolute path the agent must write output.json to.
+	EnvOutputPath = "AINVOKE_OUTPUT_PATH"
+	// EnvInputSchemaPath is the absolute path of input.schema.json.
+	EnvInputSchemaPath = "AINVOKE_INPUT_SCHEMA_PATH"
+	// EnvOutputSchemaPath is the absolute path of output.schema.json.
+	EnvOutputSchemaPath = "AINVOKE_OUTPUT_SCHEMA_PATH"
+)
+
@@ -0,0 +1,169 @@
+package ainvoke
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// idleTailSize bounds the output kept for the idle timeout error.
+	idleTailSize = 4 << 10
+	// idleTailLines is the number of output lines quoted in the error.
+	idleTailLines = 10
+	// maxIdlePollInterval bounds how often the run directory is scanned.
+	maxIdlePollInterval = time.Second
+	minIdlePollInterval = 10 * time.Millisecond
+)
+
+// idleMonitor cancels a run when the agent has produced no output and changed
+// no file in the run directory for the configured duration.
+type idleMonitor struct {
+	timeout time.Duration
+	runDir  string
+
+	mu       sync.Mutex
+	last     time.Time
+	lastMod  time.Time
+	tail     []byte
+	stopped  chan struct{}
+	finished chan struct{}
+}
+
+// watchIdle starts an idle monitor for a single attempt. The returned context
+// is canceled with ErrIdleTimeout as its cause once the agent goes idle; stop
+// must be called when the attempt is over. A zero timeout disables monitoring
+// and returns a nil monitor.
+func watchIdle(ctx context.Context, runDir string, timeout time.Duration) (context.Context, *idleMonitor, func()) {
+	if timeout <= 0 {
+		return ctx, nil, func() {}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	m := &idleMonitor{
+		timeout:  timeout,
+		runDir:   runDir,
+		last:     time.Now(),
+		lastMod:  newestModTime(runDir),
+		stopped:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	go m.run(runCtx, cancel)
+
+	return runCtx, m, func() {
+		close(m.stopped)
+		<-m.finished
+		cancel(nil)
+	}
+}
+
+func (m *idleMonitor) run(ctx context.Context, cancel context.CancelCauseFunc) {
+	defer close(m.finished)
+
+	interval := min(max(m.timeout/4, minIdlePollInterval), maxIdlePollInterval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		if mod := newestModTime(m.runDir); mod.After(m.lastMod) {
+			m.lastMod = mod
+			m.touch(nil)
+		}
+
+		if m.idleFor() >= m.timeout {
+			cancel(ErrIdleTimeout)
+
+			return
+		}
+	}
+}
+
+// Write records output as activity; it is used as an extra stream sink.
+func (m *idleMonitor) Write(p []byte) (int, error) {
+	m.touch(p)
+
+	return len(p), nil
+}
+
+func (m *idleMonitor) touch(p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.last = time.Now()
+
+	m.tail = append(m.tail, p...)
+	if len(m.tail) > idleTailSize {
+		m.tail = append(m.tail[:0], m.tail[len(m.tail)-idleTailSize:]...)
+	}
+}
+
+func (m *idleMonitor) idleFor() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return time.Since(m.last)
+}
+
+// error describes the idle timeout that stopped the agent with err, quoting
+// the last lines of output.
+func (m *idleMonitor) error(err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = fmt.Errorf("%w after %s without output or file changes: %w", ErrIdleTimeout, m.timeout, err)
+
+	if lines := lastLines(m.tail, idleTailLines); lines != "" {
+		err = fmt.Errorf("%w; last output:\n%s", err, lines)
+	}
+
+	return err
+}
+
+// newestModTime returns the latest modification time in dir, including dir
+// itself, which changes when entries are created, renamed or removed.
+func newestModTime(dir string) time.Time {
+	var newest time.Time
+
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return newest
+}
+
+// lastLines returns up to n trailing lines of data.
+func lastLines(data []byte, n int) string {
+	text := strings.TrimRight(string(data), "\r\n")
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,92 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunIdleTimeout(t *testing.T) {
+	for _, tty := range []bool{false, true} {
+		t.Run("tty="+strconv.FormatBool(tty), func(t *testing.T) {
+			// The short sleep lets the terminal echo the prompt before the agent output.
+			runner := newShellRunner(t, `sleep 0.2; echo "step 1"; echo "Proceed? [y/N]"; sleep 30`)
+
+			start := time.Now()
+
+			_, err := runner.Execute(
+				context.Background(),
+				helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+				WithTTY(tty),
+				WithIdleTimeout(300*time.Millisecond),
+				WithGracePeriod(0),
+			)
+			if !errors.Is(err, ErrIdleTimeout) {
+				t.Fatalf("expected ErrIdleTimeout, got %v", err)
+			}
+			if errors.Is(err, ErrTimeout) || errors.Is(err, ErrCanceled) || errors.Is(err, ErrRunFailed) {
+				t.Fatalf("expected idle timeout only, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "Proceed? [y/N]") {
+				t.Fatalf("expected last output in error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Fatalf("expected idle agent to be stopped early, took %s", elapsed)
+			}
+
+			var runErr *RunError
+			if !errors.As(err, &runErr) || runErr.Phase != PhaseProcessExit {
+				t.Fatalf("expected process exit RunError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunIdleTimeoutActivity(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{
+			name:   "output",
+			script: `for i in 1 2 3 4 5 6; do echo "tick $i"; sleep 0.1; done`,
+		},
+		{
+			name:   "file changes",
+			script: `for i in 1 2 3 4 5 6; do : > "progress-$i"; sleep 0.1; done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := tt.script + `; printf '{"result":"ok"}' > output.json`
+			runner := newShellRunner(t, script)
+
+			_, err := runner.Execute(
+				context.Background(),
+				helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+				WithIdleTimeout(400*time.Millisecond),
+			)
+			if err != nil {
+				t.Fatalf("expected active agent to finish, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	data := []byte("one\ntwo\nthree\nfour\n\n")
+
+	if got := lastLines(data, 2); got != "three\nfour" {
+		t.Fatalf("expected last two lines, got %q", got)
+	}
+	if got := lastLines(data, 10); got != "one\ntwo\nthree\nfour" {
+		t.Fatalf("expected all lines, got %q", got)
+	}
+	if got := lastLines(nil, 2); got != "" {
+		t.Fatalf("expected empty output, got %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package ainvoke
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Normalizer is a step of the output normalization pipeline enabled with
+// WithNormalizers. Steps run in order on output.json before it is validated.
+type Normalizer interface {
+	// Name identifies the step in Result.Normalizations.
+	Name() string
+	// Normalize returns data with the fix applied and whether it changed
+	// anything. schema is the output schema of the invocation.
+	Normalize(data []byte, schema string) ([]byte, bool)
+}
+
+// NewNormalizer returns a Normalizer named name that applies fn.
+func NewNormalizer(name string, fn func(data []byte, schema string) ([]byte, bool)) Normalizer {
+	return normalizerFunc{name: name, fn: fn}
+}
+
+type normalizerFunc struct {
+	name string
+	fn   func(data []byte, schema string) ([]byte, bool)
+}
+
+func (n normalizerFunc) Name() string { return n.name }
+
+func (n normalizerFunc) Normalize(data []byte, schema string) ([]byte, bool) {
+	return n.fn(data, schema)
+}
+
+var (
+	// StripBOM removes a leading UTF-8 byte order mark.
+	StripBOM = NewNormalizer("bom", stripBOM)
+	// StripFence unwraps output written as a markdown code block.
+	StripFence = NewNormalizer("fence", stripFence)
+	// RemoveTrailingCommas drops commas before a closing bracket or brace.
+	RemoveTrailingCommas = NewNormalizer("trailing-commas", removeTrailingCommas)
+	// WrapValue wraps a value that is not an object in {"<name>": value} when
+	// the output schema is an object with a single property or a single
+	// required property.
+	WrapValue = NewNormalizer("wrap", wrapValue)
+)
+
+// DefaultNormalizers returns the built-in steps in the order they are meant to
+// run: StripBOM, StripFence, RemoveTrailingCommas and WrapValue.
+func DefaultNormalizers() []Normalizer {
+	return []Normalizer{StripBOM, StripFence, RemoveTrailingCommas, WrapValue}
+}
+
+// normalizeOutput runs steps on data and returns the result and the names of
+// the steps that changed it.
+func normalizeOutput(data []byte, schema string, steps []Normalizer) ([]byte, []string) {
+	var applied []string
+
+	for _, step := range steps {
+		out, changed := step.Normalize(data, schema)
+		if !changed {
+			continue
+		}
+
+		data = out
+		applied = append(applied, step.Name())
+	}
+
+	return data, applied
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+func stripBOM(data []byte, _ string) ([]byte, bool) {
+	if !bytes.HasPrefix(data, utf8BOM) {
+		return data, false
+	}
+
+	return data[len(utf8BOM):], true
+}
+
+func stripFence(data []byte, _ string) ([]byte, bool) {
+	text := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(text, []byte("```")) || !bytes.HasSuffix(text, []byte("```")) {
+		return data, false
+	}
+
+	// Drop the opening fence line, including an info string such as "json".
+	newline := bytes.IndexByte(text, '\n')
+	if newline < 0 {
+		return data, false
+	}
+
+	body := bytes.TrimSuffix(text[newline+1:], []byte("```"))
+
+	return append(bytes.TrimSpace(body), '\n'), true
+}
+
+func removeTrailingCommas(data []byte, _ string) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	inString, escaped, changed := false, false, false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			next := i + 1
+			for next < len(data) && isJSONSpace(data[next]) {
+				next++
+			}
+
+			if next < len(data) && (data[next] == '}' || data[next] == ']') {
+				changed = true
+
+				continue
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	if !changed {
+		return data, false
+	}
+
+	return out, true
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func wrapValue(data []byte, schema string) ([]byte, bool) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return data, false
+	}
+
+	if _, ok := value.(map[string]any); ok {
+		return data, false
+	}
+
+	name := wrapProperty(schema)
+	if name == "" {
+		return data, false
+	}
+
+	out, err := json.Marshal(map[string]json.RawMessage{name: bytes.TrimSpace(data)})
+	if err != nil {
+		return data, false
+	}
+
+	return append(out, '\n'), true
+}
+
+// wrapProperty returns the property a bare value belongs to: the only
+// required property of an object schema, or its only property.
+func wrapProperty(schema string) string {
+	var root struct {
+		Type       any                        `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+
+	if err := json.Unmarshal([]byte(schema), &root); err != nil || root.Type != "object" {
+		return ""
+	}
+
+	if len(root.Required) == 1 {
+		return root.Required[0]
+	}
+
+	if len(root.Required) == 0 && len(root.Properties) == 1 {
+		for name := range root.Properties {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,119 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		applied []string
+	}{
+		{name: "valid", data: `{"result":"ok"}`, want: `{"result":"ok"}`},
+		{name: "bom", data: "\xef\xbb\xbf{\"result\":\"ok\"}", want: `{"result":"ok"}`, applied: []string{"bom"}},
+		{
+			name:    "fence",
+			data:    "```json\n{\"result\":\"ok\"}\n```\n",
+			want:    "{\"result\":\"ok\"}\n",
+			applied: []string{"fence"},
+		},
+		{
+			name:    "trailing commas",
+			data:    `{"result":"a,}", "list":[1,2, ],}`,
+			want:    `{"result":"a,}", "list":[1,2 ]}`,
+			applied: []string{"trailing-commas"},
+		},
+		{name: "bare string", data: `"ok"`, want: "{\"result\":\"ok\"}\n", applied: []string{"wrap"}},
+		{
+			name:    "all",
+			data:    "\xef\xbb\xbf```\n[\"ok\",]\n```",
+			want:    "{\"result\":[\"ok\"]}\n",
+			applied: []string{"bom", "fence", "trailing-commas", "wrap"},
+		},
+		{name: "not json", data: `done`, want: `done`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied := normalizeOutput([]byte(tt.data), helloOutputSchema, DefaultNormalizers())
+			if string(got) != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+
+			if !slices.Equal(applied, tt.applied) {
+				t.Fatalf("expected steps %v, got %v", tt.applied, applied)
+			}
+		})
+	}
+}
+
+func TestWrapProperty(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		{schema: `{"type":"object","properties":{"output":{}}}`, want: "output"},
+		{schema: `{"type":"object","properties":{"a":{},"b":{}},"required":["b"]}`, want: "b"},
+		{schema: `{"type":"object","properties":{"a":{},"b":{}}}`},
+		{schema: `{"type":"object","required":["a","b"]}`},
+		{schema: `{"type":"string"}`},
+		{schema: `not json`},
+	}
+
+	for _, tt := range tests {
+		if got := wrapProperty(tt.schema); got != tt.want {
+			t.Errorf("wrapProperty(%s) = %q, want %q", tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestRunNormalizers(t *testing.T) {
+	runner := newShellRunner(t, "printf '\\357\\273\\277```json\\n\"ok\"\\n```' > output.json")
+
+	_, err := Execute(context.Background(), runner, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}))
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid without normalizers, got %v", err)
+	}
+
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+
+	res, err := Execute(context.Background(), runner, inv, WithNormalizers(DefaultNormalizers()...))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	want := []string{"bom", "fence", "wrap"}
+	if !slices.Equal(res.Normalizations, want) || !slices.Equal(res.Attempts[0].Normalizations, want) {
+		t.Fatalf("expected normalizations %v, got %v and %v", want, res.Normalizations, res.Attempts[0].Normalizations)
+	}
+
+	if string(res.Output) != "{\"result\":\"ok\"}\n" {
+		t.Fatalf("unexpected output %q", res.Output)
+	}
+
+	if got := readTrimmed(t, res.OutputPath); got != `{"result":"ok"}` {
+		t.Fatalf("expected normalized output.json, got %s", got)
+	}
+
+	custom := NewNormalizer("upper", func(data []byte, _ string) ([]byte, bool) {
+		return []byte(`{"result":"OK"}`), true
+	})
+
+	res, err = Execute(context.Background(), runner, inv, WithNormalizers(custom))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if string(res.Output) != `{"result":"OK"}` || !slices.Equal(res.Normalizations, []string{"upper"}) {
+		t.Fatalf("unexpected custom normalization: %s %v", res.Output, res.Normalizations)
+	}
+
+	if _, err := Execute(context.Background(), runner, inv, WithNormalizers(nil)); err == nil {
+		t.Fatal("expected error for nil normalizer")
+	}
+}
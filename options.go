@@ -3,13 +3,39 @@ package ainvoke
 import (
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"time"
 )
 
+// DefaultGracePeriod is the time an agent process group is given to exit
+// after SIGTERM before it is killed.
+const DefaultGracePeriod = 5 * time.Second
+
 // RunOptions defines the configuration for running an agent.
 type RunOptions struct {
 	stdout io.Writer
 	stderr io.Writer
 	tty    bool
+
+	repairAttempts  int
+	runDirPolicy    *RunDirPolicy
+	gracePeriod     time.Duration
+	idleTimeout     time.Duration
+	earlyCompletion bool
+	resourceLimits  ResourceLimits
+	sandbox         *Sandbox
+	env             map[string]string
+	envAllow        []string
+	envDeny         []string
+	cleanEnv        bool
+	promptTemplate  *PromptTemplate
+	promptVars      map[string]any
+	normalizers     []Normalizer
+	strictSchema    bool
+	validators      []Validator
+	acceptanceCheck *AcceptanceCheck
+	selfCheck       string
 }
 
 // RunOption configures runtime behavior for invoking an agent.
@@ -30,6 +56,154 @@ func WithTTY(enabled bool) RunOption {
 	return func(o *RunOptions) { o.tty = enabled }
 }
 
+// WithRepairAttempts re-invokes the agent up to n more times when output.json
+// is missing or fails schema validation. Each follow-up prompt carries the
+// validation errors and the previous output. Zero disables repair.
+func WithRepairAttempts(n int) RunOption {
+	return func(o *RunOptions) { o.repairAttempts = n }
+}
+
+// WithManagedRunDir makes the runner create a unique run directory for each
+// invocation inside Invocation.RunDir (or the system temporary directory when
+// it is empty) and clean it up according to policy. The directory used is
+// reported in Result.RunDir.
+func WithManagedRunDir(policy RunDirPolicy) RunOption {
+	return func(o *RunOptions) { o.runDirPolicy = &policy }
+}
+
+// WithGracePeriod sets how long the agent and the processes it spawned may
+// take to exit after SIGTERM once the context is done. Processes still alive
+// afterwards are killed. Zero kills them immediately.
+func WithGracePeriod(d time.Duration) RunOption {
+	return func(o *RunOptions) { o.gracePeriod = d }
+}
+
+// WithIdleTimeout stops the agent when it writes nothing to stdout, stderr or
+// the terminal and changes no file in the run directory for d. The error
+// matches ErrIdleTimeout and quotes the last lines of output. Zero disables
+// the idle timeout.
+func WithIdleTimeout(d time.Duration) RunOption {
+	return func(o *RunOptions) { o.idleTimeout = d }
+}
+
+// WithEarlyCompletion watches output.json while the agent runs. Once the file
+// has stopped changing and passes the output schema, the agent is terminated
+// and the run succeeds without waiting for it to exit. This suits CLIs that
+// linger or wait for more input after answering.
+func WithEarlyCompletion(enabled bool) RunOption {
+	return func(o *RunOptions) { o.earlyCompletion = enabled }
+}
+
+// WithResourceLimits sets rlimits on the agent process. See ResourceLimits.
+func WithResourceLimits(limits ResourceLimits) RunOption {
+	return func(o *RunOptions) { o.resourceLimits = limits }
+}
+
+// WithSandbox runs the agent in Linux namespaces as described by Sandbox. The
+// run and work directories stay writable.
+func WithSandbox(sandbox Sandbox) RunOption {
+	return func(o *RunOptions) { o.sandbox = &sandbox }
+}
+
+// WithEnv sets environment variables for the agent. They override inherited
+// variables and are applied after the allow and deny lists. Repeated calls
+// add to the set.
+func WithEnv(env map[string]string) RunOption {
+	return func(o *RunOptions) {
+		if len(env) == 0 {
+			return
+		}
+
+		if o.env == nil {
+			o.env = make(map[string]string, len(env))
+		}
+
+		maps.Copy(o.env, env)
+	}
+}
+
+// WithEnvAllow limits the variables the agent inherits to those matching one
+// of patterns. Patterns are names or path.Match globs such as "AWS_*".
+func WithEnvAllow(patterns ...string) RunOption {
+	return func(o *RunOptions) { o.envAllow = append(o.envAllow, patterns...) }
+}
+
+// WithEnvDeny keeps the variables matching one of patterns from being
+// inherited by the agent. Patterns are names or path.Match globs.
+func WithEnvDeny(patterns ...string) RunOption {
+	return func(o *RunOptions) { o.envDeny = append(o.envDeny, patterns...) }
+}
+
+// WithCleanEnv starts the agent without inheriting any variable, so it only
+// sees the ones set with WithEnv.
+func WithCleanEnv(enabled bool) RunOption {
+	return func(o *RunOptions) { o.cleanEnv = enabled }
+}
+
+// WithPromptTemplate renders the agent prompt with tmpl instead of
+// DefaultPromptTemplate. A nil template selects the default.
+func WithPromptTemplate(tmpl *PromptTemplate) RunOption {
+	return func(o *RunOptions) { o.promptTemplate = tmpl }
+}
+
+// WithPromptVars makes vars available to the prompt template as .Vars.
+// Repeated calls add to the set.
+func WithPromptVars(vars map[string]any) RunOption {
+	return func(o *RunOptions) {
+		if len(vars) == 0 {
+			return
+		}
+
+		if o.promptVars == nil {
+			o.promptVars = make(map[string]any, len(vars))
+		}
+
+		maps.Copy(o.promptVars, vars)
+	}
+}
+
+// WithNormalizers runs steps on output.json, in order, before it is
+// validated, and writes the result back when a step changed it. The steps
+// applied are reported in Result.Normalizations. DefaultNormalizers returns
+// the built-in steps. Repeated calls add to the pipeline.
+func WithNormalizers(steps ...Normalizer) RunOption {
+	return func(o *RunOptions) { o.normalizers = append(o.normalizers, steps...) }
+}
+
+// WithStrictSchema transforms the input and output schemas with StrictSchema
+// before input validation, prompt rendering and output validation, so agents
+// see and are held to closed object schemas. The transformed schemas are
+// also the ones written to the run directory.
+func WithStrictSchema(enabled bool) RunOption {
+	return func(o *RunOptions) { o.strictSchema = enabled }
+}
+
+// WithValidators runs validators, in order, on output that passed the output
+// schema. Their failures are reported like schema violations, match
+// ErrOutputRejected and are sent back to the agent by WithRepairAttempts.
+// Repeated calls add to the chain.
+func WithValidators(validators ...Validator) RunOption {
+	return func(o *RunOptions) { o.validators = append(o.validators, validators...) }
+}
+
+// WithAcceptanceCheck runs check in the work directory each time the agent
+// produced valid output. When it fails, the agent is re-invoked with the
+// check output appended to the prompt, up to check.Retries times, and the run
+// then fails with ErrCheckFailed. Every run of the check is recorded in
+// Result.Checks.
+func WithAcceptanceCheck(check AcceptanceCheck) RunOption {
+	return func(o *RunOptions) { o.acceptanceCheck = &check }
+}
+
+// WithSelfCheck tells the agent, in the default prompt, to run command before
+// finishing and fix the problems it reports. command is typically
+// "ainvoke check", which validates $AINVOKE_OUTPUT_PATH against
+// $AINVOKE_OUTPUT_SCHEMA_PATH; it must be runnable from the agent's shell.
+// Custom templates get it as .SelfCheckCommand.
+func WithSelfCheck(command string) RunOption {
+	return func(o *RunOptions) { o.selfCheck = command }
+}
+
 func resolveRunOptions(opts []RunOption) (RunOptions, error) {
 	out := defaultRunOptions()
 	for _, opt := range opts {
@@ -44,13 +218,60 @@ func resolveRunOptions(opts []RunOption) (RunOptions, error) {
 		return RunOptions{}, fmt.Errorf("stderr must not be nil")
 	}
 
+	if slices.Contains(out.normalizers, nil) {
+		return RunOptions{}, fmt.Errorf("normalizers must not be nil")
+	}
+
+	if slices.Contains(out.validators, nil) {
+		return RunOptions{}, fmt.Errorf("validators must not be nil")
+	}
+
+	if out.repairAttempts < 0 {
+		return RunOptions{}, fmt.Errorf("repair attempts must not be negative")
+	}
+
+	if out.gracePeriod < 0 {
+		return RunOptions{}, fmt.Errorf("grace period must not be negative")
+	}
+
+	if out.idleTimeout < 0 {
+		return RunOptions{}, fmt.Errorf("idle timeout must not be negative")
+	}
+
+	if err := out.resourceLimits.validate(); err != nil {
+		return RunOptions{}, fmt.Errorf("resource limits: %w", err)
+	}
+
+	if err := validateEnv(out.env, out.envAllow, out.envDeny); err != nil {
+		return RunOptions{}, fmt.Errorf("env: %w", err)
+	}
+
+	if out.sandbox != nil {
+		if err := out.sandbox.validate(); err != nil {
+			return RunOptions{}, fmt.Errorf("sandbox: %w", err)
+		}
+	}
+
+	if out.acceptanceCheck != nil {
+		if err := out.acceptanceCheck.validate(); err != nil {
+			return RunOptions{}, fmt.Errorf("acceptance check: %w", err)
+		}
+	}
+
+	if out.runDirPolicy != nil {
+		if err := out.runDirPolicy.validate(); err != nil {
+			return RunOptions{}, fmt.Errorf("run dir policy: %w", err)
+		}
+	}
+
 	return out, nil
 }
 
 func defaultRunOptions() RunOptions {
 	return RunOptions{
-		stdout: io.Discard,
-		stderr: io.Discard,
-		tty:    false,
+		stdout:      io.Discard,
+		stderr:      io.Discard,
+		tty:         false,
+		gracePeriod: DefaultGracePeriod,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,302 @@
+package ainvoke
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// OutputSource selects where the runner takes the agent output from.
+type OutputSource string
+
+const (
+	// OutputSourceFile reads output.json from the run directory. It is the
+	// default.
+	OutputSourceFile OutputSource = "file"
+	// OutputSourceStdout extracts the output from what the agent printed, for
+	// agents that cannot write files. The chosen value is saved as
+	// output.json before it is validated.
+	OutputSourceStdout OutputSource = "stdout"
+	// OutputSourceFileThenStdout reads output.json and falls back to stdout
+	// when the agent did not write the file.
+	OutputSourceFileThenStdout OutputSource = "file-then-stdout"
+)
+
+func (s OutputSource) validate() error {
+	switch s {
+	case "", OutputSourceFile, OutputSourceStdout, OutputSourceFileThenStdout:
+		return nil
+	default:
+		return fmt.Errorf("unknown output source %q (want file, stdout or file-then-stdout)", s)
+	}
+}
+
+// saveStdoutOutput picks the output from stdout and writes it to outputPath.
+// Candidates are fenced JSON blocks and top-level JSON objects or arrays,
+// found after stripping terminal escape sequences, and scalar values on a
+// line of their own when the output schema expects a scalar. The output
+// schema is never
+// a candidate. Values at the start of stdout that also appear in the prompt
+// are taken for a terminal echo and skipped, but only when the agent printed
+// something else after them. The last candidate that passes the output
+// schema wins; without one, the last candidate is saved so validation reports
+// why it was rejected.
+func saveStdoutOutput(stdout []byte, prompt string, inv Invocation, outputPath string) error {
+	scalars := scalarSchema(inv.OutputSchema)
+
+	echoed := make(map[string]bool)
+	for _, c := range stdoutCandidates([]byte(prompt), scalars) {
+		echoed[compactJSON(c)] = true
+	}
+
+	schemaText := compactJSON([]byte(inv.OutputSchema))
+	candidates := slices.DeleteFunc(stdoutCandidates(stdout, scalars), func(c []byte) bool {
+		return compactJSON(c) == schemaText
+	})
+
+	fresh := candidates
+	for len(fresh) > 0 && echoed[compactJSON(fresh[0])] {
+		fresh = fresh[1:]
+	}
+
+	if len(fresh) == 0 {
+		// Everything printed is in the prompt: a value that equals the
+		// input or an example is only taken when it is valid output.
+		return saveEchoedOutput(candidates, inv, outputPath)
+	}
+
+	candidates = fresh
+	chosen := candidates[len(candidates)-1]
+
+	for _, c := range slices.Backward(candidates) {
+		if err := inv.validateOutput(c); err == nil {
+			chosen = c
+
+			break
+		} else if !errors.Is(err, ErrOutputSchemaInvalid) {
+			return fmt.Errorf("validate output: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(outputPath, chosen, inputFilePerm); err != nil {
+		return fmt.Errorf("write %s: %w", outputPath, err)
+	}
+
+	return nil
+}
+
+// saveEchoedOutput saves the last candidate that passes the output schema.
+func saveEchoedOutput(candidates [][]byte, inv Invocation, outputPath string) error {
+	for _, c := range slices.Backward(candidates) {
+		err := inv.validateOutput(c)
+		if errors.Is(err, ErrOutputSchemaInvalid) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("validate output: %w", err)
+		}
+
+		if err := os.WriteFile(outputPath, c, inputFilePerm); err != nil {
+			return fmt.Errorf("write %s: %w", outputPath, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: no JSON found on stdout", ErrMissingOutput)
+}
+
+type stdoutCandidate struct {
+	offset int
+	end    int
+	value  []byte
+}
+
+// scalarSchema reports whether the top-level type of the schema is a string,
+// number, integer, boolean or null, or a list including one of them.
+func scalarSchema(schema string) bool {
+	var doc struct {
+		Type any `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(schema), &doc); err != nil {
+		return false
+	}
+
+	var types []any
+
+	switch t := doc.Type.(type) {
+	case string:
+		types = []any{t}
+	case []any:
+		types = t
+	}
+
+	return slices.ContainsFunc(types, func(t any) bool {
+		switch t {
+		case "string", "number", "integer", "boolean", "null":
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// stdoutCandidates returns the JSON values in out in the order they appear:
+// the content of fenced blocks tagged json or untagged, every top-level
+// JSON object or array and, when scalars is set, every scalar value on a line
+// of its own outside of those.
+func stdoutCandidates(out []byte, scalars bool) [][]byte {
+	text := stripTerminal(out)
+	found := append(fencedBlocks(text), topLevelJSON(text)...)
+
+	if scalars {
+		found = append(found, scalarLines(text, found)...)
+	}
+
+	slices.SortStableFunc(found, func(a, b stdoutCandidate) int { return cmp.Compare(a.offset, b.offset) })
+
+	values := make([][]byte, 0, len(found))
+	for _, c := range found {
+		values = append(values, c.value)
+	}
+
+	return values
+}
+
+// fencedBlocks returns the content of every complete fenced code block in
+// text that is tagged json or not tagged at all and holds valid JSON.
+func fencedBlocks(text []byte) []stdoutCandidate {
+	var (
+		found   []stdoutCandidate
+		inFence bool
+		isJSON  bool
+		start   int
+		offset  int
+		current bytes.Buffer
+	)
+
+	for line := range strings.Lines(string(text)) {
+		lineStart := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+
+		if !inFence {
+			if info, ok := strings.CutPrefix(trimmed, "```"); ok {
+				inFence = true
+				isJSON = info == "" || strings.EqualFold(info, "json")
+				start = lineStart
+				current.Reset()
+			}
+
+			continue
+		}
+
+		if trimmed == "```" {
+			inFence = false
+
+			block := bytes.TrimSpace(current.Bytes())
+			if isJSON && json.Valid(block) {
+				found = append(found, stdoutCandidate{offset: start, end: offset, value: bytes.Clone(block)})
+			}
+
+			continue
+		}
+
+		current.WriteString(line)
+	}
+
+	return found
+}
+
+// topLevelJSON returns the JSON objects and arrays in text that are not
+// nested in another one. Scanning resumes at the byte a decode failed on, so
+// every byte is decoded about once however large the text is.
+func topLevelJSON(text []byte) []stdoutCandidate {
+	var found []stdoutCandidate
+
+	for i := 0; i < len(text); {
+		if text[i] != '{' && text[i] != '[' {
+			i++
+
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(text[i:]))
+
+		var value json.RawMessage
+
+		var syntaxErr *json.SyntaxError
+
+		err := dec.Decode(&value)
+		if errors.As(err, &syntaxErr) {
+			// Offset counts the bytes read up to and including the bad
+			// one, which may itself start a value.
+			i += max(int(syntaxErr.Offset)-1, 1)
+
+			continue
+		} else if err != nil {
+			// The rest of text is an unfinished value.
+			break
+		}
+
+		end := i + int(dec.InputOffset())
+		found = append(found, stdoutCandidate{offset: i, end: end, value: bytes.Clone(value)})
+		i = end
+	}
+
+	return found
+}
+
+// scalarLines returns the lines of text that hold a JSON string, number,
+// boolean or null and lie outside of the candidates in found.
+func scalarLines(text []byte, found []stdoutCandidate) []stdoutCandidate {
+	var (
+		scalars []stdoutCandidate
+		offset  int
+	)
+
+	for line := range bytes.Lines(text) {
+		lineStart := offset
+		offset += len(line)
+
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' || !json.Valid(trimmed) {
+			continue
+		}
+
+		inside := slices.ContainsFunc(found, func(c stdoutCandidate) bool {
+			return lineStart < c.end && c.offset < offset
+		})
+		if !inside {
+			scalars = append(scalars, stdoutCandidate{offset: lineStart, end: offset, value: bytes.Clone(trimmed)})
+		}
+	}
+
+	return scalars
+}
+
+// terminalEscape matches CSI and OSC sequences and other two-byte escapes a
+// terminal transcript may contain.
+var terminalEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripTerminal removes escape sequences and carriage returns from a terminal
+// transcript.
+func stripTerminal(out []byte) []byte {
+	out = terminalEscape.ReplaceAll(out, nil)
+
+	return bytes.ReplaceAll(out, []byte("\r"), nil)
+}
+
+func compactJSON(data []byte) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return string(data)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,242 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdoutCandidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		scalars bool
+		want    []string
+	}{
+		{name: "none", out: "no output here {not json}"},
+		{name: "json block", out: "Sure!\n```json\n\"done\"\n```\nDone.", want: []string{`"done"`}},
+		{name: "untagged block", out: "```\n{\"a\":1}\n```", want: []string{`{"a":1}`, `{"a":1}`}},
+		{name: "other languages skipped", out: "```go\nfmt.Println(\"x\")\n```\n```json\n1\n```", want: []string{"1"}},
+		{name: "unterminated block", out: "```json\n\"a\"\n"},
+		{
+			name: "top-level values only",
+			out:  `Result: {"a":{"b":[1,2]}} and then [3] trailing`,
+			want: []string{`{"a":{"b":[1,2]}}`, "[3]"},
+		},
+		{
+			name: "terminal transcript",
+			out:  "\x1b[?25l\x1b[32m{\"result\":\r\n \"ok\"}\x1b[0m\r\n\x1b]0;title\x07",
+			want: []string{"{\"result\":\n \"ok\"}"},
+		},
+		{name: "resume at failed byte", out: `{{"a":1}} {oops} [1, 2 x] {"b":2}`, want: []string{`{"a":1}`, `{"b":2}`}},
+		{
+			name: "deeply nested garbage",
+			out:  strings.Repeat(`[{"a":`, 100000) + "x\n" + `{"result":"x"}`,
+			want: []string{`{"result":"x"}`},
+		},
+		{name: "scalars not expected", out: "\"ok\"\n42"},
+		{
+			name:    "scalar lines",
+			out:     "Answer:\n\"ok\"\n 42 \nnot \"this\"\n[\n  \"nested\"\n]\n```json\ntrue\n```\nnull",
+			scalars: true,
+			want:    []string{`"ok"`, "42", "[\n  \"nested\"\n]", "true", "null"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stdoutCandidates([]byte(tt.out), tt.scalars)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+
+			for i := range got {
+				if string(got[i]) != tt.want[i] {
+					t.Fatalf("expected %q, got %q", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveStdoutOutput(t *testing.T) {
+	const prompt = "Input JSON:\n" + `{"result":"Ada"}` + "\n" + `{"name":"Ada"}` + "\nOutput JSON Schema:\n" + helloOutputSchema
+	outputPath := filepath.Join(t.TempDir(), OutputFileName)
+
+	tests := []struct {
+		name    string
+		stdout  string
+		want    string
+		wantErr error
+	}{
+		{name: "last valid wins", stdout: `{"result":"a"} {"result":"b"} {"other":1}`, want: `{"result":"b"}`},
+		{name: "invalid saved for repair", stdout: `{"draft":1} {"other":1}`, want: `{"other":1}`},
+		{name: "echoed schema ignored", stdout: "Output JSON Schema:\n" + helloOutputSchema, wantErr: ErrMissingOutput},
+		{name: "echo skipped", stdout: prompt + "\n" + `{"result":"Ada"} {"result":"b"}`, want: `{"result":"b"}`},
+		{name: "echoed value kept later", stdout: `{"result":"b"} {"result":"Ada"}`, want: `{"result":"Ada"}`},
+		{name: "output equal to input", stdout: `{"result":"Ada"}`, want: `{"result":"Ada"}`},
+		{name: "echoed invalid value", stdout: `{"name":"Ada"}`, wantErr: ErrMissingOutput},
+		{name: "nothing", stdout: "I could not do it.", wantErr: ErrMissingOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := saveStdoutOutput([]byte(tt.stdout), prompt, Invocation{OutputSchema: helloOutputSchema}, outputPath)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			if got := readTrimmed(t, outputPath); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSaveStdoutOutputScalar(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), OutputFileName)
+	inv := Invocation{OutputSchema: `{"type":"string","enum":["yes","no"]}`}
+
+	if err := saveStdoutOutput([]byte("Thinking...\n\"yes\"\n"), "", inv, outputPath); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	if got := readTrimmed(t, outputPath); got != `"yes"` {
+		t.Fatalf("expected \"yes\", got %s", got)
+	}
+}
+
+func TestScalarSchema(t *testing.T) {
+	tests := map[string]bool{
+		`{"type":"integer"}`:          true,
+		`{"type":["object","null"]}`:  true,
+		`{"type":"object"}`:           false,
+		`{"type":["array","object"]}`: false,
+		`{"enum":["a"]}`:              false,
+		`{`:                           false,
+	}
+
+	for schema, want := range tests {
+		if got := scalarSchema(schema); got != want {
+			t.Errorf("scalarSchema(%s) = %v, want %v", schema, got, want)
+		}
+	}
+}
+
+func TestRunFileThenStdoutOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{name: "file", script: `printf '{"result":"file"}' > output.json; echo '{"result":"stdout"}'`, want: `{"result":"file"}`},
+		{name: "stdout fallback", script: `echo 'Here you go: {"result":"stdout"}'`, want: `{"result":"stdout"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", tt.script}, OutputSource: OutputSourceFileThenStdout})
+			if err != nil {
+				t.Fatalf("new runner: %v", err)
+			}
+
+			res, err := runner.Execute(context.Background(), helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}))
+			if err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if string(res.Output) != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, res.Output)
+			}
+		})
+	}
+
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", "echo nothing"}, OutputSource: OutputSourceFileThenStdout})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	_, err = runner.Execute(context.Background(), helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}))
+	if !errors.Is(err, ErrMissingOutput) {
+		t.Fatalf("expected ErrMissingOutput, got %v", err)
+	}
+}
+
+func TestRunInlineInputStdoutOutput(t *testing.T) {
+	// The agent cannot see the run directory: it answers from the prompt alone.
+	script := `name=$(sed -n 's/.*"name":"\([^"]*\)".*/\1/p')
+printf 'Thinking...\n` + "```json" + `\n{"result":"Hello, %s!"}\n` + "```" + `\n' "$name"`
+
+	for _, tty := range []bool{false, true} {
+		runDir := t.TempDir()
+
+		runner, err := NewRunner(AgentConfig{
+			Cmd:          []string{"sh", "-c", script},
+			UseTTY:       tty,
+			InlineInput:  true,
+			OutputSource: OutputSourceStdout,
+		})
+		if err != nil {
+			t.Fatalf("new runner: %v", err)
+		}
+
+		res, err := runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}))
+		if err != nil {
+			t.Fatalf("execute (tty=%v): %v", tty, err)
+		}
+
+		if string(res.Output) != `{"result":"Hello, Ada!"}` {
+			t.Errorf("unexpected output (tty=%v): %s", tty, res.Output)
+		}
+
+		if strings.Contains(res.Prompt, res.InputPath) || !strings.Contains(res.Prompt, `{"name":"Ada"}`) {
+			t.Errorf("expected the input inline in the prompt (tty=%v):\n%s", tty, res.Prompt)
+		}
+
+		saved, err := os.ReadFile(filepath.Join(runDir, OutputFileName))
+		if err != nil || string(saved) != string(res.Output) {
+			t.Errorf("expected output.json to hold the stdout block (tty=%v), got %q, %v", tty, saved, err)
+		}
+	}
+}
+
+func TestRunStdoutOutputRepair(t *testing.T) {
+	runDir := t.TempDir()
+	script := `if grep -q 'Repair Required' ; then printf '` + "```json" + `\n{"result":"fixed"}\n` + "```" + `\n'; else echo 'no block'; fi`
+
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", script}, OutputSource: OutputSourceStdout})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	_, err = runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}))
+	if !errors.Is(err, ErrMissingOutput) {
+		t.Fatalf("expected ErrMissingOutput, got %v", err)
+	}
+
+	res, err := runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}), WithRepairAttempts(1))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if string(res.Output) != `{"result":"fixed"}` || !strings.Contains(res.Prompt, "print corrected output JSON") {
+		t.Fatalf("unexpected repair result %s:\n%s", res.Output, res.Prompt)
+	}
+}
+
+func TestOutputSourceValidation(t *testing.T) {
+	if _, err := NewRunner(AgentConfig{Cmd: []string{"agent"}, OutputSource: "socket"}); err == nil {
+		t.Fatal("expected error for unknown output source")
+	}
+}
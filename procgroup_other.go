@@ -0,0 +1,20 @@
+//go:build !unix
+
+package ainvoke
+
+import (
+	"os/exec"
+	"time"
+)
+
+// processGroup falls back to killing the agent process alone on platforms
+// without process groups.
+type processGroup struct{}
+
+func newProcessGroup(cmd *exec.Cmd, grace time.Duration, _ bool) *processGroup {
+	cmd.WaitDelay = grace
+
+	return &processGroup{}
+}
+
+func (g *processGroup) wait() {}
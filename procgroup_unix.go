@@ -0,0 +1,136 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// processGroup terminates an agent together with every process it spawned.
+// The agent is started as a process group leader; on cancellation the whole
+// group gets SIGTERM, followed by SIGKILL once the grace period has passed.
+type processGroup struct {
+	cmd   *exec.Cmd
+	grace time.Duration
+
+	mu     sync.Mutex
+	timer  *time.Timer
+	killed chan struct{}
+}
+
+// newProcessGroup configures cmd to run in its own process group. When
+// newGroup is false the caller is responsible for that, e.g. because the
+// command is started in a new session.
+func newProcessGroup(cmd *exec.Cmd, grace time.Duration, newGroup bool) *processGroup {
+	g := &processGroup{cmd: cmd, grace: grace, killed: make(chan struct{})}
+
+	if newGroup {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+
+		cmd.SysProcAttr.Setpgid = true
+	}
+
+	cmd.Cancel = g.terminate
+	// WaitDelay bounds how long Wait blocks on the leader and on pipes held
+	// open by surviving children once the context is done.
+	cmd.WaitDelay = grace + killWaitDelay
+
+	return g
+}
+
+// killWaitDelay is the time left for the process group to die after SIGKILL
+// before Wait gives up on it.
+const killWaitDelay = time.Second
+
+func (g *processGroup) terminate() error {
+	pid := g.cmd.Process.Pid
+	err := signalGroup(pid, syscall.SIGTERM)
+
+	g.mu.Lock()
+	g.timer = time.AfterFunc(g.grace, func() {
+		_ = signalGroup(pid, syscall.SIGKILL)
+		close(g.killed)
+	})
+	g.mu.Unlock()
+
+	return err
+}
+
+// wait is called after the leader has been reaped. If the group was
+// terminated and any member outlived the leader, it blocks until the group
+// has been killed.
+func (g *processGroup) wait() {
+	g.mu.Lock()
+	timer := g.timer
+	g.mu.Unlock()
+
+	if timer == nil {
+		return
+	}
+
+	if !groupAlive(g.cmd.Process.Pid) && timer.Stop() {
+		return
+	}
+
+	<-g.killed
+}
+
+// groupAlive reports whether process group pgid has a member that is not a
+// zombie. Orphaned children are reaped by init, which may take a while, so
+// where /proc is available zombies are skipped.
+func groupAlive(pgid int) bool {
+	if signalGroup(pgid, 0) != nil {
+		return false
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return true
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// The fields after the parenthesised command are: state ppid pgrp ...
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+
+		if pgrp, err := strconv.Atoi(fields[2]); err == nil && pgrp == pgid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func signalGroup(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTimeoutKillsProcessGroup(t *testing.T) {
+	runDir := t.TempDir()
+	runner := newShellRunner(t, `sleep 30 & echo $! > child.pid; wait`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := runner.Execute(ctx, helloInvocation(runDir, map[string]any{"name": "Ada"}), WithGracePeriod(time.Second))
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if errors.Is(err, ErrRunFailed) || errors.Is(err, ErrCanceled) {
+		t.Fatalf("expected timeout only, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Phase != PhaseProcessExit {
+		t.Fatalf("expected process exit RunError, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(runDir, "child.pid"))
+	if err != nil {
+		t.Fatalf("read child pid: %v", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("parse child pid: %v", err)
+	}
+	if processRunning(pid) {
+		t.Fatalf("expected child process %d to be terminated", pid)
+	}
+}
+
+func TestRunGracePeriodEscalatesToKill(t *testing.T) {
+	runner := newShellRunner(t, `trap '' TERM; sleep 30`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := runner.Execute(ctx, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}), WithGracePeriod(200*time.Millisecond))
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected agent to be killed after the grace period, took %s", elapsed)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	for _, tty := range []bool{false, true} {
+		t.Run("tty="+strconv.FormatBool(tty), func(t *testing.T) {
+			runner := newShellRunner(t, `sleep 30`)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(200*time.Millisecond, cancel)
+
+			_, err := runner.Execute(ctx, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}), WithTTY(tty))
+			if !errors.Is(err, ErrCanceled) {
+				t.Fatalf("expected ErrCanceled, got %v", err)
+			}
+			if errors.Is(err, ErrTimeout) || errors.Is(err, ErrRunFailed) {
+				t.Fatalf("expected cancellation only, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunIgnoresLingeringChildOutput(t *testing.T) {
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p'); printf '{"result":"ok"}' > "$out"; sleep 5 &`)
+
+	start := time.Now()
+
+	_, err := runner.Execute(context.Background(), helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}), WithGracePeriod(0))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected run to finish without waiting for the child, took %s", elapsed)
+	}
+}
+
+// processRunning reports whether pid is alive and not a zombie.
+func processRunning(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+
+	return len(fields) > 0 && fields[0] != "Z"
+}
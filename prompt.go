@@ -0,0 +1,274 @@
+package ainvoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// DefaultPromptTemplate is the prompt template used when no other one is set
+// with WithPromptTemplate. It is a text/template executed with PromptData.
+const DefaultPromptTemplate = `{{- if .SystemPrompt -}}
+System Prompt:
+{{ .SystemPrompt }}
+
+{{- end -}}
+I/O Requirements:
+- Read input JSON schema (text below).
+- Read output JSON schema (text below).
+{{ if .InlineInput -}}
+- Read input JSON (text below).
+{{ else -}}
+- Read input JSON from: {{ .InputPath }}
+{{ end -}}
+- Produce output JSON that conforms to the output schema.
+{{ if .StdoutOutput -}}
+- Print output JSON to stdout in a fenced code block starting with a ` + "```json" + ` line and ending with a ` + "```" + ` line.
+{{ else -}}
+- Write output JSON to: {{ .OutputPath }}
+{{ end -}}
+{{ if .SelfCheckCommand -}}
+- Before finishing, run ` + "`{{ .SelfCheckCommand }}`" + ` and fix every problem it reports until it prints ok.
+{{ end }}
+Input JSON Schema:
+{{ .InputSchema }}
+
+Output JSON Schema:
+{{ .OutputSchema }}
+{{ if .InlineInput }}
+Input JSON:
+{{ .InputJSON }}
+{{ else }}
+Note: Input JSON content is provided via the input file path above.
+{{ end -}}
+`
+
+// PromptData is the data a prompt template is executed with.
+type PromptData struct {
+	SystemPrompt string
+	// InputPath and OutputPath are the absolute paths of input.json and
+	// output.json.
+	InputPath  string
+	OutputPath string
+	// InputSchema and OutputSchema are the schema texts; InputSchemaPath and
+	// OutputSchemaPath are the files they were written to.
+	InputSchema      string
+	OutputSchema     string
+	InputSchemaPath  string
+	OutputSchemaPath string
+	RunDir           string
+	WorkDir          string
+	// Input is the content of input.json decoded into a generic value, and
+	// InputJSON the content itself.
+	Input     any
+	InputJSON string
+	// InlineInput and StdoutOutput report the AgentConfig InlineInput and
+	// OutputSourceStdout settings the prompt has to describe.
+	InlineInput  bool
+	StdoutOutput bool
+	// SelfCheckCommand is the command set with WithSelfCheck. It is empty
+	// when the output is taken from stdout, since there is no file to check.
+	SelfCheckCommand string
+	// Vars holds the variables set with WithPromptVars.
+	Vars map[string]any
+}
+
+// PromptTemplate is a parsed and checked prompt template. Create one with
+// NewPromptTemplate.
+type PromptTemplate struct {
+	tmpl *template.Template
+}
+
+// promptFuncs are the functions available to prompt templates in addition to
+// the text/template builtins.
+var promptFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+
+		return string(data), err
+	},
+}
+
+// NewPromptTemplate parses text as a text/template executed with PromptData.
+// Besides the builtins, templates can call json to encode a value, as in
+// {{ json .Input }}. Fields of PromptData are checked up front, so a typo
+// such as {{ .InputPth }} fails here rather than on the first run.
+func NewPromptTemplate(text string) (*PromptTemplate, error) {
+	tmpl, err := template.New("prompt").Funcs(promptFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt template: %w", err)
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+
+		// Only the main template is known to run with PromptData as dot;
+		// named templates may be invoked with anything.
+		if err := checkPromptFields(t.Root, t.Name() == tmpl.Name()); err != nil {
+			return nil, fmt.Errorf("check prompt template %s: %w", t.Name(), err)
+		}
+	}
+
+	return &PromptTemplate{tmpl: tmpl}, nil
+}
+
+// checkPromptFields reports references to fields PromptData does not have.
+// Fields of dot are checked while dot is known to be PromptData, fields of $
+// everywhere.
+func checkPromptFields(node parse.Node, dotIsData bool) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, child := range n.Nodes {
+			if err := checkPromptFields(child, dotIsData); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPromptFields(n.Pipe, dotIsData)
+	case *parse.TemplateNode:
+		return checkPromptFields(n.Pipe, dotIsData)
+	case *parse.IfNode:
+		return checkPromptBranch(&n.BranchNode, dotIsData, dotIsData)
+	case *parse.RangeNode:
+		return checkPromptBranch(&n.BranchNode, dotIsData, false)
+	case *parse.WithNode:
+		return checkPromptBranch(&n.BranchNode, dotIsData, false)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkPromptFields(arg, dotIsData); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.ChainNode:
+		return checkPromptFields(n.Node, dotIsData)
+	case *parse.FieldNode:
+		if dotIsData {
+			return checkPromptField(n.Ident[0])
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			return checkPromptField(n.Ident[1])
+		}
+	}
+
+	return nil
+}
+
+func checkPromptBranch(n *parse.BranchNode, dotIsData, listDotIsData bool) error {
+	if err := checkPromptFields(n.Pipe, dotIsData); err != nil {
+		return err
+	}
+
+	if err := checkPromptFields(n.List, listDotIsData); err != nil {
+		return err
+	}
+
+	return checkPromptFields(n.ElseList, dotIsData)
+}
+
+func checkPromptField(name string) error {
+	if _, ok := reflect.TypeFor[PromptData]().FieldByName(name); !ok {
+		return fmt.Errorf("unknown field %q", name)
+	}
+
+	return nil
+}
+
+// promptOptions configures how agentPrompt renders the prompt.
+type promptOptions struct {
+	template     *PromptTemplate
+	vars         map[string]any
+	inlineInput  bool
+	stdoutOutput bool
+	selfCheck    string
+}
+
+func agentPrompt(inv Invocation, opts promptOptions) (string, error) {
+	inputPath, err := filepath.Abs(filepath.Join(inv.RunDir, InputFileName))
+	if err != nil {
+		return "", fmt.Errorf("absolute input path: %w", err)
+	}
+
+	outputPath, err := filepath.Abs(filepath.Join(inv.RunDir, OutputFileName))
+	if err != nil {
+		return "", fmt.Errorf("absolute output path: %w", err)
+	}
+
+	inputData, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", inputPath, err)
+	}
+
+	if strings.TrimSpace(inv.InputSchema) == "" {
+		return "", ErrInputSchemaEmpty
+	}
+
+	if strings.TrimSpace(inv.OutputSchema) == "" {
+		return "", ErrOutputSchemaEmpty
+	}
+
+	data := PromptData{
+		SystemPrompt:     inv.SystemPrompt,
+		InputPath:        inputPath,
+		OutputPath:       outputPath,
+		InputSchema:      inv.InputSchema,
+		OutputSchema:     inv.OutputSchema,
+		InputSchemaPath:  filepath.Join(filepath.Dir(inputPath), InputSchemaFileName),
+		OutputSchemaPath: filepath.Join(filepath.Dir(inputPath), OutputSchemaFileName),
+		RunDir:           filepath.Dir(inputPath),
+		WorkDir:          inv.WorkDir,
+		InputJSON:        string(inputData),
+		InlineInput:      opts.inlineInput,
+		StdoutOutput:     opts.stdoutOutput,
+		Vars:             opts.vars,
+	}
+
+	if !opts.stdoutOutput {
+		data.SelfCheckCommand = opts.selfCheck
+	}
+
+	if err := json.Unmarshal(inputData, &data.Input); err != nil {
+		return "", fmt.Errorf("decode %s: %w", inputPath, err)
+	}
+
+	tmpl := opts.template
+	if tmpl == nil {
+		tmpl = defaultPromptTemplate
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render prompt template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+var defaultPromptTemplate = mustPromptTemplate(DefaultPromptTemplate)
+
+func mustPromptTemplate(text string) *PromptTemplate {
+	tmpl, err := NewPromptTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return tmpl
+}
@@ -0,0 +1,125 @@
+package ainvoke
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewPromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "default", text: DefaultPromptTemplate},
+		{name: "input and vars", text: "{{ .Input.name }} {{ .Vars.team }} {{ json .Input }}"},
+		{name: "range over vars", text: "{{ range $k, $v := .Vars }}{{ $k }}={{ $v }} {{ $.OutputPath }}{{ end }}"},
+		{name: "with input", text: "{{ with .Input }}{{ .anything }}{{ else }}{{ .InputPath }}{{ end }}"},
+		{name: "named template", text: `{{ define "rules" }}{{ .whatever }}{{ end }}{{ template "rules" .Vars }}`},
+		{name: "parse error", text: "{{ .Input", wantErr: "parse prompt template"},
+		{name: "unknown field", text: "{{ .InputPth }}", wantErr: `unknown field "InputPth"`},
+		{name: "unknown field in if", text: "{{ if .Debug }}x{{ end }}", wantErr: `unknown field "Debug"`},
+		{name: "unknown root field", text: "{{ range .Vars }}{{ $.Nope }}{{ end }}", wantErr: `unknown field "Nope"`},
+		{name: "unknown function", text: "{{ yaml .Input }}", wantErr: "parse prompt template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPromptTemplate(tt.text)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunPromptTemplate(t *testing.T) {
+	runDir := t.TempDir()
+	tmpl, err := NewPromptTemplate(`House rules for {{ .Vars.team }}:
+- Greet {{ .Input.name }}.
+- Write {{ json .Input }} results to {{ .OutputPath }} ({{ .OutputSchemaPath }}).
+`)
+	if err != nil {
+		t.Fatalf("new prompt template: %v", err)
+	}
+
+	runner := newShellRunner(t, `cat > prompt.txt; printf '{"result":"ok"}' > output.json`)
+
+	res, err := runner.Execute(
+		context.Background(),
+		helloInvocation(runDir, map[string]any{"name": "Ada"}),
+		WithPromptTemplate(tmpl),
+		WithPromptVars(map[string]any{"team": "platform"}),
+	)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	want := "House rules for platform:\n- Greet Ada.\n- Write {\n  \"name\": \"Ada\"\n} results to " +
+		res.OutputPath + " (" + res.OutputSchemaPath + ").\n"
+	if res.Prompt != want {
+		t.Fatalf("unexpected prompt:\n%s", res.Prompt)
+	}
+
+	sent, err := os.ReadFile(filepath.Join(runDir, "prompt.txt"))
+	if err != nil {
+		t.Fatalf("read prompt: %v", err)
+	}
+	if string(sent) != want {
+		t.Fatalf("agent received a different prompt:\n%s", sent)
+	}
+}
+
+func TestSelfCheckPrompt(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"result":"ok"}' > output.json`)
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+
+	res, err := runner.Execute(context.Background(), inv)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if strings.Contains(res.Prompt, "Before finishing") {
+		t.Fatalf("expected no self-check line by default, got:\n%s", res.Prompt)
+	}
+
+	res, err = runner.Execute(context.Background(), inv, WithSelfCheck("ainvoke check"))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	want := "- Write output JSON to: " + res.OutputPath + "\n" +
+		"- Before finishing, run `ainvoke check` and fix every problem it reports until it prints ok.\n\n" +
+		"Input JSON Schema:"
+	if !strings.Contains(res.Prompt, want) {
+		t.Fatalf("expected self-check line, got:\n%s", res.Prompt)
+	}
+
+	stdoutRunner, err := NewRunner(AgentConfig{
+		Cmd:          []string{"sh", "-c", `echo '{"result":"ok"}'`},
+		OutputSource: OutputSourceStdout,
+	})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	res, err = stdoutRunner.Execute(context.Background(), inv, WithSelfCheck("ainvoke check"))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if strings.Contains(res.Prompt, "Before finishing") {
+		t.Fatalf("expected no self-check line for stdout output, got:\n%s", res.Prompt)
+	}
+}
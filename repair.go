@@ -0,0 +1,96 @@
+package ainvoke
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// isRepairable reports whether a follow-up prompt may fix err.
+func isRepairable(err error) bool {
+	return errors.Is(err, ErrMissingOutput) || errors.Is(err, ErrOutputSchemaInvalid) ||
+		errors.Is(err, ErrOutputRejected)
+}
+
+// outputProblems flattens an output error into the messages shown to the agent.
+func outputProblems(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		problems := make([]string, 0, len(validationErr.Failures))
+		for _, f := range validationErr.Failures {
+			problems = append(problems, f.String())
+		}
+
+		return problems
+	}
+
+	return []string{err.Error()}
+}
+
+// repairPrompt extends the original prompt with the problems found in the
+// previous attempt and the output it produced.
+func repairPrompt(prompt string, inv Invocation, attempt int, outErr error, stdoutOutput bool) (string, error) {
+	outputPath, err := filepath.Abs(filepath.Join(inv.RunDir, OutputFileName))
+	if err != nil {
+		return "", fmt.Errorf("absolute output path: %w", err)
+	}
+
+	data := repairData{
+		Attempt:      attempt,
+		Problems:     outputProblems(outErr),
+		OutputPath:   outputPath,
+		StdoutOutput: stdoutOutput,
+	}
+
+	if previous, err := os.ReadFile(outputPath); err == nil {
+		data.PreviousOutput = string(previous)
+	}
+
+	tmpl, err := template.New("repair").Parse(repairPromptTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse repair template: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(prompt)
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render repair template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+type repairData struct {
+	Attempt        int
+	Problems       []string
+	PreviousOutput string
+	OutputPath     string
+	StdoutOutput   bool
+}
+
+var repairPromptTemplate = `
+Repair Required:
+Attempt {{ .Attempt }} did not produce valid output. Problems found:
+{{- range .Problems }}
+- {{ . }}
+{{- end }}
+{{- if .PreviousOutput }}
+
+Previous output JSON:
+{{ .PreviousOutput }}
+{{- end }}
+
+{{ if .StdoutOutput -}}
+Fix the problems above and print corrected output JSON that conforms to the output schema to stdout in a fenced code block starting with a ` + "```json" + ` line and ending with a ` + "```" + ` line.
+{{ else -}}
+Fix the problems above and write corrected output JSON that conforms to the output schema to: {{ .OutputPath }}
+{{ end -}}
+`
@@ -0,0 +1,74 @@
+package ainvoke
+
+import (
+	"fmt"
+	"time"
+)
+
+// ResourceLimits caps the resources of the agent process. Zero fields leave
+// the corresponding limit unchanged. The limits are set before the agent
+// command is executed, so every process it spawns inherits them. They are
+// only supported on unix systems.
+type ResourceLimits struct {
+	// CPUTime limits CPU time (RLIMIT_CPU), rounded up to whole seconds. Each
+	// process that exceeds it is killed.
+	CPUTime time.Duration
+	// AddressSpace limits virtual memory in bytes (RLIMIT_AS).
+	AddressSpace uint64
+	// OpenFiles limits the number of open file descriptors (RLIMIT_NOFILE).
+	OpenFiles uint64
+	// Processes limits the number of processes of the user running the agent
+	// (RLIMIT_NPROC). The kernel counts all processes of that user, and the
+	// limit does not apply to root.
+	Processes uint64
+}
+
+func (l ResourceLimits) isZero() bool {
+	return l == ResourceLimits{}
+}
+
+func (l ResourceLimits) validate() error {
+	if l.CPUTime < 0 {
+		return fmt.Errorf("cpu time must not be negative")
+	}
+
+	return nil
+}
+
+// cpuSeconds returns CPUTime rounded up to whole seconds.
+func (l ResourceLimits) cpuSeconds() uint64 {
+	return uint64((l.CPUTime + time.Second - 1) / time.Second)
+}
+
+// Usage reports the resources used by the agent, as returned by wait4(2) for
+// the agent process and the descendants it waited for.
+type Usage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the peak resident set size in bytes.
+	MaxRSS int64
+	// VoluntaryContextSwitches counts waits for a resource, such as I/O.
+	VoluntaryContextSwitches int64
+	// InvoluntaryContextSwitches counts preemptions by the scheduler.
+	InvoluntaryContextSwitches int64
+}
+
+// add combines the usage of two attempts: times and context switches are
+// summed and MaxRSS is the larger peak. Either side may be nil.
+func (u *Usage) add(other *Usage) *Usage {
+	if u == nil {
+		return other
+	}
+
+	if other == nil {
+		return u
+	}
+
+	return &Usage{
+		UserTime:                   u.UserTime + other.UserTime,
+		SystemTime:                 u.SystemTime + other.SystemTime,
+		MaxRSS:                     max(u.MaxRSS, other.MaxRSS),
+		VoluntaryContextSwitches:   u.VoluntaryContextSwitches + other.VoluntaryContextSwitches,
+		InvoluntaryContextSwitches: u.InvoluntaryContextSwitches + other.InvoluntaryContextSwitches,
+	}
+}
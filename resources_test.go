@@ -0,0 +1,34 @@
+package ainvoke
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsageAdd(t *testing.T) {
+	a := &Usage{UserTime: time.Second, SystemTime: time.Second, MaxRSS: 100, VoluntaryContextSwitches: 1, InvoluntaryContextSwitches: 2}
+	b := &Usage{UserTime: 2 * time.Second, SystemTime: 0, MaxRSS: 50, VoluntaryContextSwitches: 3, InvoluntaryContextSwitches: 4}
+
+	want := &Usage{UserTime: 3 * time.Second, SystemTime: time.Second, MaxRSS: 100, VoluntaryContextSwitches: 4, InvoluntaryContextSwitches: 6}
+	if got := a.add(b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	var none *Usage
+	if got := none.add(b); got != b {
+		t.Fatalf("expected nil usage to take the other side, got %+v", got)
+	}
+	if got := a.add(nil); got != a {
+		t.Fatalf("expected nil other to be ignored, got %+v", got)
+	}
+}
+
+func TestResourceLimitsCPUSeconds(t *testing.T) {
+	if got := (ResourceLimits{CPUTime: 1500 * time.Millisecond}).cpuSeconds(); got != 2 {
+		t.Fatalf("expected 2 seconds, got %d", got)
+	}
+	if err := (ResourceLimits{CPUTime: -time.Second}).validate(); err == nil {
+		t.Fatal("expected error for negative cpu time")
+	}
+}
@@ -0,0 +1,60 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var rlimitResources = map[string]int{
+	"cpu":    unix.RLIMIT_CPU,
+	"as":     unix.RLIMIT_AS,
+	"nofile": unix.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+}
+
+// rlimitArgs encodes limits as init arguments of the form rlimit=name:value.
+func rlimitArgs(limits ResourceLimits) []string {
+	var args []string
+
+	for _, l := range []struct {
+		name  string
+		value uint64
+	}{
+		{"cpu", limits.cpuSeconds()},
+		{"as", limits.AddressSpace},
+		{"nofile", limits.OpenFiles},
+		{"nproc", limits.Processes},
+	} {
+		if l.value != 0 {
+			args = append(args, "rlimit="+l.name+":"+strconv.FormatUint(l.value, 10))
+		}
+	}
+
+	return args
+}
+
+// setRlimit applies a limit encoded by rlimitArgs to the current process.
+func setRlimit(arg string) error {
+	name, value, _ := strings.Cut(arg, ":")
+
+	resource, ok := rlimitResources[name]
+	if !ok {
+		return fmt.Errorf("unknown resource %q", name)
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse %s limit: %w", name, err)
+	}
+
+	if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: n, Max: n}); err != nil {
+		return fmt.Errorf("set %s limit: %w", name, err)
+	}
+
+	return nil
+}
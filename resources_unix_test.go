@@ -0,0 +1,93 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunResourceLimits(t *testing.T) {
+	runDir := t.TempDir()
+	runner := newShellRunner(t, `echo "$(ulimit -n) $(ulimit -t)" > limits.txt; printf '{"result":"ok"}' > output.json`)
+
+	for _, tty := range []bool{false, true} {
+		res, err := runner.Execute(
+			context.Background(),
+			helloInvocation(runDir, map[string]any{"name": "Ada"}),
+			WithTTY(tty),
+			WithResourceLimits(ResourceLimits{CPUTime: 1500 * time.Millisecond, OpenFiles: 64}),
+		)
+		if err != nil {
+			t.Fatalf("execute (tty=%v): %v", tty, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(runDir, "limits.txt"))
+		if err != nil {
+			t.Fatalf("read limits: %v", err)
+		}
+		if got := strings.TrimSpace(string(data)); got != "64 2" {
+			t.Fatalf("expected limits %q (tty=%v), got %q", "64 2", tty, got)
+		}
+		if res.Usage == nil || res.Usage.MaxRSS <= 0 {
+			t.Fatalf("expected resource usage (tty=%v), got %+v", tty, res.Usage)
+		}
+	}
+}
+
+func TestRunCPULimitKillsAgent(t *testing.T) {
+	runner := newShellRunner(t, `while :; do :; done`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := runner.Execute(
+		ctx,
+		helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+		WithResourceLimits(ResourceLimits{CPUTime: time.Second}),
+	)
+	if !errors.Is(err, ErrRunFailed) {
+		t.Fatalf("expected ErrRunFailed, got %v", err)
+	}
+	if res.Usage == nil || res.Usage.UserTime+res.Usage.SystemTime < 500*time.Millisecond {
+		t.Fatalf("expected CPU time to be reported, got %+v", res.Usage)
+	}
+}
+
+func TestRunResourceLimitsMissingCommand(t *testing.T) {
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"ainvoke-test-missing-binary"}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	_, err = runner.Execute(
+		context.Background(),
+		helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+		WithResourceLimits(ResourceLimits{OpenFiles: 64}),
+	)
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Phase != PhaseProcessStart {
+		t.Fatalf("expected process start RunError, got %v", err)
+	}
+}
+
+func TestRunResourceLimitsWithoutInit(t *testing.T) {
+	initEnabled.Store(false)
+	t.Cleanup(func() { initEnabled.Store(true) })
+
+	_, err := Execute(
+		context.Background(),
+		newShellRunner(t, `printf '{"result":"ok"}' > output.json`),
+		helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+		WithResourceLimits(ResourceLimits{OpenFiles: 64}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "MaybeRunInit") {
+		t.Fatalf("expected an error asking for MaybeRunInit, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package ainvoke
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Result describes a completed run.
+type Result struct {
+	// Output is the content of output.json once it passed validation.
+	Output json.RawMessage
+	// Stdout and Stderr hold the streams captured from the last attempt. In TTY
+	// mode the terminal transcript is in Stdout and Stderr is empty.
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is the exit code of the last attempt.
+	ExitCode int
+	// EarlyCompletion reports that the agent was stopped by WithEarlyCompletion
+	// after it wrote valid output. ExitCode then reflects the termination.
+	EarlyCompletion bool
+	// Usage is the resource usage of the agent, summed over attempts with the
+	// largest MaxRSS. It is nil where the platform does not report it.
+	Usage *Usage
+	// Duration is the wall time of the whole run, including repair attempts.
+	Duration time.Duration
+	// Prompt is the prompt sent to the agent on the last attempt.
+	Prompt string
+	// Argv is the agent command line of the last attempt, including the
+	// prompt when it is delivered as an argument.
+	Argv []string
+	// RunDir and WorkDir are the absolute directories used. With
+	// WithManagedRunDir, RunDir may already have been removed.
+	RunDir  string
+	WorkDir string
+	// InputPath and OutputPath are the absolute paths of input.json and
+	// output.json.
+	InputPath  string
+	OutputPath string
+	// InputSchemaPath and OutputSchemaPath are the absolute paths of the
+	// schema files written next to input.json.
+	InputSchemaPath  string
+	OutputSchemaPath string
+	// RunID identifies the run. It is exported to the agent as AINVOKE_RUN_ID
+	// and is empty for runners that do not implement ResultRunner.
+	RunID string
+	// Normalizations names the WithNormalizers steps that changed the output
+	// of the last attempt, in the order they ran.
+	Normalizations []string
+	// Checks holds one entry per run of the acceptance check, in order.
+	Checks []CheckResult
+	// Attempts holds one entry per agent invocation, in order. A run without
+	// repair has a single attempt.
+	Attempts []Attempt
+}
+
+// Attempt records the outcome of a single agent invocation.
+type Attempt struct {
+	// Errors lists the problems found after the attempt; it is empty when the
+	// attempt produced valid output.
+	Errors []string
+	// Normalizations names the WithNormalizers steps that changed the output
+	// of the attempt.
+	Normalizations []string
+}
+
+// Diagnostics returns the captured output most likely to explain a failure:
+// stderr when the agent wrote any, stdout otherwise.
+func (r *Result) Diagnostics() []byte {
+	if len(r.Stderr) > 0 {
+		return r.Stderr
+	}
+
+	return r.Stdout
+}
+
+func (r *Result) setPaths(inv Invocation) {
+	r.RunDir = inv.RunDir
+	r.WorkDir = inv.WorkDir
+	r.InputPath = filepath.Join(inv.RunDir, InputFileName)
+	r.OutputPath = filepath.Join(inv.RunDir, OutputFileName)
+}
+
+// contractEnv returns the AINVOKE_* variables describing the run.
+func (r *Result) contractEnv() map[string]string {
+	return map[string]string{
+		EnvRunID:            r.RunID,
+		EnvRunDir:           r.RunDir,
+		EnvInputPath:        r.InputPath,
+		EnvOutputPath:       r.OutputPath,
+		EnvInputSchemaPath:  r.InputSchemaPath,
+		EnvOutputSchemaPath: r.OutputSchemaPath,
+	}
+}
+
+// ResultRunner is implemented by runners that report a structured Result.
+type ResultRunner interface {
+	Execute(ctx context.Context, inv Invocation, opts ...RunOption) (*Result, error)
+}
+
+// Execute runs inv with r and returns a Result.
+//
+// Runners that only implement Runner keep working: the streams and exit code
+// come from Run, and Output is read from output.json in the run directory when
+// the run succeeded. Such runners are trusted to have validated it.
+func Execute(ctx context.Context, r Runner, inv Invocation, opts ...RunOption) (*Result, error) {
+	if rr, ok := r.(ResultRunner); ok {
+		return rr.Execute(ctx, inv, opts...)
+	}
+
+	res := &Result{}
+	start := time.Now()
+
+	outBytes, errBytes, exitCode, err := r.Run(ctx, inv, opts...)
+	res.Duration = time.Since(start)
+	res.Stdout, res.Stderr, res.ExitCode = outBytes, errBytes, exitCode
+	res.Attempts = []Attempt{{Errors: outputProblems(err)}}
+
+	if dirErr := resolveDirs(&inv); dirErr == nil {
+		res.setPaths(inv)
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	if data, readErr := os.ReadFile(res.OutputPath); readErr == nil {
+		res.Output = data
+	}
+
+	return res, nil
+}
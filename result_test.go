@@ -0,0 +1,104 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecuteResult(t *testing.T) {
+	runDir := t.TempDir()
+	script := `out=$(sed -n 's/^- Write output JSON to: //p'); echo working; printf '{"result":"ok"}' > "$out"`
+	runner := newShellRunner(t, script)
+
+	res, err := runner.Execute(context.Background(), helloInvocation(runDir, map[string]any{"name": "Ada"}))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	if strings.TrimSpace(string(res.Stdout)) != "working" {
+		t.Errorf("unexpected stdout %q", res.Stdout)
+	}
+	if res.ExitCode != 0 {
+		t.Errorf("unexpected exit code %d", res.ExitCode)
+	}
+	if res.Duration <= 0 {
+		t.Error("expected wall time to be recorded")
+	}
+	if !strings.Contains(res.Prompt, "I/O Requirements:") {
+		t.Errorf("expected rendered prompt, got %q", res.Prompt)
+	}
+	if !reflect.DeepEqual(res.Argv, []string{"sh", "-c", script}) {
+		t.Errorf("unexpected argv %v", res.Argv)
+	}
+	if res.RunDir != runDir || res.WorkDir != runDir {
+		t.Errorf("unexpected dirs %q, %q", res.RunDir, res.WorkDir)
+	}
+	if res.InputPath != filepath.Join(runDir, InputFileName) || res.OutputPath != filepath.Join(runDir, OutputFileName) {
+		t.Errorf("unexpected paths %q, %q", res.InputPath, res.OutputPath)
+	}
+	if len(res.Attempts) != 1 {
+		t.Errorf("expected a single attempt, got %d", len(res.Attempts))
+	}
+}
+
+func TestExecuteResultOnFailure(t *testing.T) {
+	runner := newShellRunner(t, `echo boom >&2; exit 4`)
+
+	res, err := runner.Execute(context.Background(), helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}))
+	if !errors.Is(err, ErrRunFailed) {
+		t.Fatalf("expected ErrRunFailed, got %v", err)
+	}
+	if res.ExitCode != 4 {
+		t.Errorf("expected exit code 4, got %d", res.ExitCode)
+	}
+	if strings.TrimSpace(string(res.Diagnostics())) != "boom" {
+		t.Errorf("unexpected diagnostics %q", res.Diagnostics())
+	}
+	if res.Output != nil {
+		t.Errorf("expected no output, got %q", res.Output)
+	}
+}
+
+type legacyRunner struct {
+	outBytes []byte
+	err      error
+}
+
+func (r legacyRunner) Run(context.Context, Invocation, ...RunOption) ([]byte, []byte, int, error) {
+	return r.outBytes, nil, 0, r.err
+}
+
+func TestExecuteLegacyRunner(t *testing.T) {
+	runDir := t.TempDir()
+	writeFile(t, runDir, OutputFileName, `{"result":"ok"}`)
+
+	res, err := Execute(context.Background(), legacyRunner{outBytes: []byte("log")}, Invocation{RunDir: runDir})
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	if string(res.Diagnostics()) != "log" {
+		t.Errorf("expected stdout diagnostics, got %q", res.Diagnostics())
+	}
+	if res.OutputPath != filepath.Join(runDir, OutputFileName) {
+		t.Errorf("unexpected output path %q", res.OutputPath)
+	}
+
+	boom := errors.New("boom")
+	res, err = Execute(context.Background(), legacyRunner{err: boom}, Invocation{RunDir: runDir})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected runner error, got %v", err)
+	}
+	if res.Output != nil {
+		t.Errorf("expected no output on failure, got %q", res.Output)
+	}
+}
@@ -0,0 +1,171 @@
+package ainvoke
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CleanupPolicy selects what happens to a managed run directory once a run
+// finishes.
+type CleanupPolicy int
+
+const (
+	// CleanupAlways removes the run directory after every run.
+	CleanupAlways CleanupPolicy = iota + 1
+	// CleanupOnSuccess removes the run directory only when the run succeeded,
+	// leaving failed runs behind for inspection.
+	CleanupOnSuccess
+	// CleanupKeepLast keeps the most recent finished run directories and
+	// removes older ones. It needs an explicit base directory, since other
+	// processes' run directories may share the system temporary directory.
+	CleanupKeepLast
+)
+
+const (
+	runDirPattern        = "ainvoke-run-*"
+	runDirCompleteMarker = ".ainvoke-complete"
+	runDirPerm           = 0o755
+)
+
+// RunDirPolicy configures managed run directories. See WithManagedRunDir.
+type RunDirPolicy struct {
+	Cleanup CleanupPolicy
+	// KeepLast is the number of finished run directories retained by
+	// CleanupKeepLast.
+	KeepLast int
+}
+
+// ParseCleanupPolicy parses "always", "on-success" or "keep-last".
+func ParseCleanupPolicy(s string) (CleanupPolicy, error) {
+	switch s {
+	case "always":
+		return CleanupAlways, nil
+	case "on-success":
+		return CleanupOnSuccess, nil
+	case "keep-last":
+		return CleanupKeepLast, nil
+	default:
+		return 0, fmt.Errorf("unknown cleanup policy %q (want always, on-success or keep-last)", s)
+	}
+}
+
+func (p RunDirPolicy) validate() error {
+	switch p.Cleanup {
+	case CleanupAlways, CleanupOnSuccess:
+		return nil
+	case CleanupKeepLast:
+		if p.KeepLast < 1 {
+			return fmt.Errorf("keep-last cleanup requires KeepLast >= 1")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown cleanup policy %d", p.Cleanup)
+	}
+}
+
+// createRunDir creates a unique run directory under base, which defaults to
+// the system temporary directory unless the policy prunes old directories.
+func createRunDir(base string, policy RunDirPolicy) (string, error) {
+	if base == "" {
+		if policy.Cleanup == CleanupKeepLast {
+			return "", errors.New("keep-last cleanup requires a run directory base")
+		}
+
+		base = os.TempDir()
+	}
+
+	if err := os.MkdirAll(base, runDirPerm); err != nil {
+		return "", fmt.Errorf("create %s: %w", base, err)
+	}
+
+	dir, err := os.MkdirTemp(base, runDirPattern)
+	if err != nil {
+		return "", fmt.Errorf("create run dir in %s: %w", base, err)
+	}
+
+	return filepath.Abs(dir)
+}
+
+// finishRunDir applies the cleanup policy to a run directory. Directories are
+// marked complete first so that pruning never touches a run still in progress.
+func finishRunDir(dir string, policy RunDirPolicy, success bool) error {
+	switch policy.Cleanup {
+	case CleanupAlways:
+		return os.RemoveAll(dir)
+	case CleanupOnSuccess:
+		if success {
+			return os.RemoveAll(dir)
+		}
+
+		return markRunDirComplete(dir)
+	case CleanupKeepLast:
+		if err := markRunDirComplete(dir); err != nil {
+			return err
+		}
+
+		return pruneRunDirs(filepath.Dir(dir), policy.KeepLast)
+	default:
+		return nil
+	}
+}
+
+func markRunDirComplete(dir string) error {
+	marker := filepath.Join(dir, runDirCompleteMarker)
+	if err := os.WriteFile(marker, nil, inputFilePerm); err != nil {
+		return fmt.Errorf("write %s: %w", marker, err)
+	}
+
+	return nil
+}
+
+// pruneRunDirs removes all but the newest keep completed run directories in base.
+func pruneRunDirs(base string, keep int) error {
+	matches, err := filepath.Glob(filepath.Join(base, runDirPattern))
+	if err != nil {
+		return fmt.Errorf("list run dirs: %w", err)
+	}
+
+	type finished struct {
+		path string
+		at   time.Time
+	}
+
+	dirs := make([]finished, 0, len(matches))
+
+	for _, path := range matches {
+		info, err := os.Stat(filepath.Join(path, runDirCompleteMarker))
+		if err != nil {
+			continue
+		}
+
+		dirs = append(dirs, finished{path: path, at: info.ModTime()})
+	}
+
+	if len(dirs) <= keep {
+		return nil
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].at.Equal(dirs[j].at) {
+			return strings.Compare(dirs[i].path, dirs[j].path) > 0
+		}
+
+		return dirs[i].at.After(dirs[j].at)
+	})
+
+	var errs []error
+
+	for _, d := range dirs[keep:] {
+		if err := os.RemoveAll(d.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -29,6 +29,11 @@ const (
 }`
 )
 
+func TestMain(m *testing.M) {
+	MaybeRunInit()
+	os.Exit(m.Run())
+}
+
 func TestNewRunnerRequiresCmd(t *testing.T) {
 	if _, err := NewRunner(AgentConfig{}); err == nil {
 		t.Fatal("expected error for empty cmd")
@@ -87,6 +92,58 @@ func TestRunSuccessHelloWorldWithTTY(t *testing.T) {
 	}
 }
 
+func TestRunHelloWorldSeparateWorkDir(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	inv.WorkDir = t.TempDir()
+	runner := newGoRunRunner(t, "helloagent")
+
+	res, err := runner.Execute(context.Background(), inv)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if string(res.Output) != `{"result":"Hello, Ada!"}` {
+		t.Fatalf("unexpected output: %s", res.Output)
+	}
+}
+
+func TestRunContractEnv(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	script := `env | grep '^AINVOKE_' | sort > "$AINVOKE_RUN_DIR/env.txt"
+cmp -s "$AINVOKE_OUTPUT_SCHEMA_PATH" /dev/null || printf '{"result":"ok"}' > "$AINVOKE_OUTPUT_PATH"`
+	t.Setenv(EnvRunID, "outer")
+
+	res, err := newShellRunner(t, script).Execute(context.Background(), inv, WithCleanEnv(true))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if res.RunID == "" || res.RunID == "outer" {
+		t.Fatalf("unexpected run id %q", res.RunID)
+	}
+
+	want := strings.Join([]string{
+		EnvInputPath + "=" + filepath.Join(runDir, InputFileName),
+		EnvInputSchemaPath + "=" + filepath.Join(runDir, InputSchemaFileName),
+		EnvOutputPath + "=" + filepath.Join(runDir, OutputFileName),
+		EnvOutputSchemaPath + "=" + filepath.Join(runDir, OutputSchemaFileName),
+		EnvRunDir + "=" + runDir,
+		EnvRunID + "=" + res.RunID,
+	}, "\n")
+	if got := readTrimmed(t, filepath.Join(runDir, "env.txt")); got != want {
+		t.Fatalf("expected env\n%s\ngot\n%s", want, got)
+	}
+
+	for path, schema := range map[string]string{
+		res.InputSchemaPath:  helloInputSchema,
+		res.OutputSchemaPath: helloOutputSchema,
+	} {
+		if got := readTrimmed(t, path); got != strings.TrimSpace(schema) {
+			t.Errorf("unexpected schema in %s: %s", path, got)
+		}
+	}
+}
+
 func TestRunMissingRunDir(t *testing.T) {
 	runDir := filepath.Join(t.TempDir(), "missing")
 	runner := newGoRunRunner(t, "helloagent")
@@ -140,6 +197,176 @@ func TestRunExistingInputFile(t *testing.T) {
 	}
 }
 
+func TestRunSeparateWorkDir(t *testing.T) {
+	runDir := t.TempDir()
+	workDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	inv.WorkDir = workDir
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p')
+printf '{"result":"%s"}' "$(pwd)" > "$out"`)
+
+	if _, _, _, err := runner.Run(context.Background(), inv); err != nil {
+		t.Fatalf("run with work dir: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(runDir, OutputFileName))
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	var got struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal output: %v", err)
+	}
+	wantDir, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		t.Fatalf("eval symlinks: %v", err)
+	}
+	if got.Result != wantDir {
+		t.Fatalf("expected agent to run in %q, got %q", wantDir, got.Result)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, InputFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no input.json in work dir, stat err = %v", err)
+	}
+}
+
+func TestRunMissingWorkDir(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	inv.WorkDir = filepath.Join(t.TempDir(), "missing")
+	runner := newShellRunner(t, `true`)
+
+	_, _, _, err := runner.Run(context.Background(), inv)
+	if !errors.Is(err, ErrMissingWorkDir) {
+		t.Fatalf("expected ErrMissingWorkDir, got %v", err)
+	}
+}
+
+func TestRunManagedRunDir(t *testing.T) {
+	const script = `out=$(sed -n 's/^- Write output JSON to: //p'); printf '{"result":"ok"}' > "$out"`
+
+	t.Run("cleanup always", func(t *testing.T) {
+		base := t.TempDir()
+		runner := newShellRunner(t, script)
+
+		res, err := runner.Execute(
+			context.Background(),
+			helloInvocation(base, map[string]any{"name": "Ada"}),
+			WithManagedRunDir(RunDirPolicy{Cleanup: CleanupAlways}),
+		)
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if filepath.Dir(res.RunDir) != base {
+			t.Fatalf("expected run dir under %q, got %q", base, res.RunDir)
+		}
+		if _, err := os.Stat(res.RunDir); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected run dir removed, stat err = %v", err)
+		}
+		if string(res.Output) != `{"result":"ok"}` {
+			t.Fatalf("unexpected output %q", res.Output)
+		}
+	})
+
+	t.Run("cleanup on success keeps failed runs", func(t *testing.T) {
+		base := t.TempDir()
+		runner := newShellRunner(t, `exit 1`)
+
+		res, err := runner.Execute(
+			context.Background(),
+			helloInvocation(base, map[string]any{"name": "Ada"}),
+			WithManagedRunDir(RunDirPolicy{Cleanup: CleanupOnSuccess}),
+		)
+		if !errors.Is(err, ErrRunFailed) {
+			t.Fatalf("expected ErrRunFailed, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(res.RunDir, InputFileName)); err != nil {
+			t.Fatalf("expected failed run dir to be kept: %v", err)
+		}
+	})
+
+	t.Run("keep last", func(t *testing.T) {
+		base := t.TempDir()
+		runner := newShellRunner(t, script)
+		policy := RunDirPolicy{Cleanup: CleanupKeepLast, KeepLast: 2}
+
+		dirs := make(map[string]bool)
+		for range 3 {
+			res, err := runner.Execute(
+				context.Background(),
+				helloInvocation(base, map[string]any{"name": "Ada"}),
+				WithManagedRunDir(policy),
+			)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			dirs[res.RunDir] = true
+		}
+
+		if len(dirs) != 3 {
+			t.Fatalf("expected a unique run dir per run, got %d", len(dirs))
+		}
+
+		entries, err := os.ReadDir(base)
+		if err != nil {
+			t.Fatalf("read base dir: %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 run dirs kept, got %d", len(entries))
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		runner := newShellRunner(t, script)
+
+		_, _, _, err := runner.Run(
+			context.Background(),
+			helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+			WithManagedRunDir(RunDirPolicy{Cleanup: CleanupKeepLast}),
+		)
+		if err == nil {
+			t.Fatal("expected error for keep-last without KeepLast")
+		}
+	})
+
+	t.Run("keep last needs a base", func(t *testing.T) {
+		runner := newShellRunner(t, script)
+
+		_, err := runner.Execute(
+			context.Background(),
+			helloInvocation("", map[string]any{"name": "Ada"}),
+			WithManagedRunDir(RunDirPolicy{Cleanup: CleanupKeepLast, KeepLast: 1}),
+		)
+		if err == nil || !strings.Contains(err.Error(), "requires a run directory base") {
+			t.Fatalf("expected error for keep-last in the temp dir, got %v", err)
+		}
+	})
+}
+
+func TestParseCleanupPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    CleanupPolicy
+		wantErr bool
+	}{
+		{in: "always", want: CleanupAlways},
+		{in: "on-success", want: CleanupOnSuccess},
+		{in: "keep-last", want: CleanupKeepLast},
+		{in: "never", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCleanupPolicy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseCleanupPolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseCleanupPolicy(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestRunInputSchemaEmpty(t *testing.T) {
 	runDir := t.TempDir()
 	runner := newGoRunRunner(t, "helloagent")
@@ -196,6 +423,22 @@ func TestRunInputSchemaInvalidSpec(t *testing.T) {
 	}
 }
 
+func TestRunOutputSchemaInvalidSpec(t *testing.T) {
+	runner := newShellRunner(t, "cat >/dev/null")
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+	inv.OutputSchema = "{"
+
+	_, err := runner.Execute(context.Background(), inv)
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Phase != PhaseOutputValidation {
+		t.Fatalf("expected output validation RunError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "validate output schema") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestRunInputMarshalError(t *testing.T) {
 	runDir := t.TempDir()
 	runner := newGoRunRunner(t, "helloagent")
@@ -342,6 +585,11 @@ func TestRunOptionsValidation(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for nil stdout")
 	}
+
+	_, _, _, err = runner.Run(context.Background(), inv, WithRepairAttempts(-1))
+	if err == nil {
+		t.Fatal("expected error for negative repair attempts")
+	}
 }
 
 func TestRunMissingOutput(t *testing.T) {
@@ -390,6 +638,80 @@ func TestRunOutputSchemaInvalid(t *testing.T) {
 	}
 }
 
+func TestRunRepairsInvalidOutput(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	runner := newShellRunner(t, `if grep -q "Repair Required"; then
+  printf '{"result":"fixed"}' > output.json
+else
+  printf '{"result":1}' > output.json
+fi`)
+
+	res, err := runner.Execute(context.Background(), inv, WithRepairAttempts(2))
+	if err != nil {
+		t.Fatalf("run with repair: %v", err)
+	}
+	if len(res.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(res.Attempts))
+	}
+	if len(res.Attempts[0].Errors) == 0 {
+		t.Fatal("expected first attempt to record validation errors")
+	}
+	if len(res.Attempts[1].Errors) != 0 {
+		t.Fatalf("expected second attempt to succeed, got %v", res.Attempts[1].Errors)
+	}
+}
+
+func TestRunRepairExhausted(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	runner := newShellRunner(t, `cat > prompt.txt; printf '{"result":1}' > output.json`)
+
+	res, err := runner.Execute(context.Background(), inv, WithRepairAttempts(1))
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+	if len(res.Attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(res.Attempts))
+	}
+
+	prompt, err := os.ReadFile(filepath.Join(runDir, "prompt.txt"))
+	if err != nil {
+		t.Fatalf("read prompt: %v", err)
+	}
+	if !strings.Contains(string(prompt), "Invalid type. Expected: string, given: integer") {
+		t.Fatalf("expected schema error in repair prompt, got %q", prompt)
+	}
+	if !strings.Contains(string(prompt), `{"result":1}`) {
+		t.Fatalf("expected previous output in repair prompt, got %q", prompt)
+	}
+}
+
+func TestRunRepairSkipsFailedExit(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	runner := newShellRunner(t, `exit 3`)
+
+	res, err := runner.Execute(context.Background(), inv, WithRepairAttempts(2))
+	if !errors.Is(err, ErrRunFailed) {
+		t.Fatalf("expected ErrRunFailed, got %v", err)
+	}
+	if len(res.Attempts) != 1 {
+		t.Fatalf("expected a single attempt, got %d", len(res.Attempts))
+	}
+}
+
+func TestRunOutputInvalidJSON(t *testing.T) {
+	runDir := t.TempDir()
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	runner := newShellRunner(t, `printf 'not json' > output.json`)
+
+	_, _, _, err := runner.Run(context.Background(), inv)
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+}
+
 func TestRunExitNonZero(t *testing.T) {
 	runDir := t.TempDir()
 	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
@@ -513,7 +835,7 @@ func TestRunPromptPassedWithTTY(t *testing.T) {
 func TestAgentPromptErrors(t *testing.T) {
 	runDir := t.TempDir()
 
-	if _, err := agentPrompt(Invocation{RunDir: runDir, InputSchema: helloInputSchema, OutputSchema: helloOutputSchema}); err == nil {
+	if _, err := agentPrompt(Invocation{RunDir: runDir, InputSchema: helloInputSchema, OutputSchema: helloOutputSchema}, promptOptions{}); err == nil {
 		t.Fatal("expected error for missing input.json")
 	}
 
@@ -521,10 +843,10 @@ func TestAgentPromptErrors(t *testing.T) {
 		t.Fatalf("write input: %v", err)
 	}
 
-	if _, err := agentPrompt(Invocation{RunDir: runDir, OutputSchema: helloOutputSchema}); err == nil {
+	if _, err := agentPrompt(Invocation{RunDir: runDir, OutputSchema: helloOutputSchema}, promptOptions{}); err == nil {
 		t.Fatal("expected error for empty input schema")
 	}
-	if _, err := agentPrompt(Invocation{RunDir: runDir, InputSchema: helloInputSchema}); err == nil {
+	if _, err := agentPrompt(Invocation{RunDir: runDir, InputSchema: helloInputSchema}, promptOptions{}); err == nil {
 		t.Fatal("expected error for empty output schema")
 	}
 }
@@ -541,48 +863,47 @@ func TestAgentPromptTemplateErrors(t *testing.T) {
 		OutputSchema: helloOutputSchema,
 	}
 
-	original := promptTemplate
-	t.Cleanup(func() { promptTemplate = original })
-
-	promptTemplate = "{{"
-	if _, err := agentPrompt(inv); err == nil {
+	if _, err := NewPromptTemplate("{{"); err == nil {
 		t.Fatal("expected parse error")
 	}
 
-	promptTemplate = "{{ call .SystemPrompt }}"
-	if _, err := agentPrompt(inv); err == nil {
+	tmpl, err := NewPromptTemplate("{{ call .SystemPrompt }}")
+	if err != nil {
+		t.Fatalf("new prompt template: %v", err)
+	}
+	if _, err := agentPrompt(inv, promptOptions{template: tmpl}); err == nil {
 		t.Fatal("expected execute error")
 	}
 }
 
 func TestRunCommandErrors(t *testing.T) {
-	if _, _, _, err := runCommand(context.Background(), nil, ".", nil, nil, nil); err == nil {
+	if _, err := runCommand(context.Background(), nil, ".", nil, nil, nil, processOptions{}); err == nil {
 		t.Fatal("expected error for empty argv")
 	}
-	if _, _, _, err := runCommand(context.Background(), []string{"definitely-missing-binary"}, ".", nil, nil, nil); err == nil {
+	if _, err := runCommand(context.Background(), []string{"definitely-missing-binary"}, ".", nil, nil, nil, processOptions{}); err == nil {
 		t.Fatal("expected error for missing binary")
 	}
 }
 
 func TestRunCommandWithTTYErrors(t *testing.T) {
-	if _, _, _, err := runCommandWithTTY(context.Background(), nil, ".", nil, nil); err == nil {
+	if _, err := runCommandWithTTY(context.Background(), nil, ".", nil, nil, processOptions{}); err == nil {
 		t.Fatal("expected error for empty argv")
 	}
-	if _, _, _, err := runCommandWithTTY(context.Background(), []string{"definitely-missing-binary"}, ".", nil, nil); err == nil {
+	if _, err := runCommandWithTTY(context.Background(), []string{"definitely-missing-binary"}, ".", nil, nil, processOptions{}); err == nil {
 		t.Fatal("expected error for missing binary")
 	}
 }
 
-func TestValidateOutputSchemaErrors(t *testing.T) {
-	err := validateOutputSchema("", "missing.json")
+func TestValidateOutputErrors(t *testing.T) {
+	err := validateOutput("", []byte(`{"result":"ok"}`))
 	if err == nil {
 		t.Fatal("expected error for empty output schema")
 	}
 	if !errors.Is(err, ErrOutputSchemaEmpty) {
 		t.Fatal("expected ErrOutputSchemaEmpty")
 	}
-	if err := validateOutputSchema(helloOutputSchema, "missing.json"); err == nil {
-		t.Fatal("expected error reading missing output file")
+	if err := validateOutput("{", []byte(`{"result":"ok"}`)); err == nil {
+		t.Fatal("expected error for invalid output schema")
 	}
 }
 
@@ -619,6 +940,31 @@ func newGoRunRunner(t *testing.T, agentName string) *ExecRunner {
 	return runner
 }
 
+func newShellRunner(t *testing.T, script string) *ExecRunner {
+	t.Helper()
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", script}})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+	return runner
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+func readTrimmed(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
 func repoRoot(t *testing.T) string {
 	t.Helper()
 	root, err := os.Getwd()
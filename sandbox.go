@@ -0,0 +1,29 @@
+package ainvoke
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Sandbox isolates the agent with Linux user, mount and optionally network
+// namespaces. Inside the sandbox the whole filesystem is read-only except the
+// run directory, the work directory and WritablePaths, and /tmp is a private
+// tmpfs. The agent keeps the caller's user and group IDs.
+type Sandbox struct {
+	// DisableNetwork runs the agent in a new network namespace without any
+	// configured interface.
+	DisableNetwork bool
+	// WritablePaths lists additional files or directories that stay writable,
+	// such as an agent's state directory in the home directory.
+	WritablePaths []string
+}
+
+func (s Sandbox) validate() error {
+	for _, path := range s.WritablePaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("writable path %q must be absolute", path)
+		}
+	}
+
+	return nil
+}
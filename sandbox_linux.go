@@ -0,0 +1,250 @@
+//go:build linux
+
+package ainvoke
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// configureSandbox starts cmd in new user and mount namespaces, and a new
+// network namespace when networking is disabled. It returns the init
+// arguments that make the child finish the setup before exec.
+func configureSandbox(cmd *exec.Cmd, sandbox Sandbox, writable []string) ([]string, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	attr := cmd.SysProcAttr
+
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if sandbox.DisableNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	// A process that is not root in the namespace loses its capabilities on
+	// exec, so the init gets CAP_SYS_ADMIN for the mounts as an ambient
+	// capability. It clears it before exec, and the agent keeps the caller's
+	// uid without capabilities.
+	attr.AmbientCaps = append(attr.AmbientCaps, unix.CAP_SYS_ADMIN)
+
+	args := []string{"sandbox"}
+	for _, path := range writable {
+		args = append(args, "writable="+path)
+	}
+
+	return args, nil
+}
+
+// sandboxSetup is run by the init inside the new namespaces.
+type sandboxSetup struct {
+	enabled  bool
+	writable []string
+}
+
+// sandboxSkipped lists mount trees left as they are: devices must stay
+// writable and proc cannot be remounted without a new PID namespace.
+var sandboxSkipped = []string{"/dev", "/proc"}
+
+func (s sandboxSetup) setup() error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get work dir: %w", err)
+	}
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	// Hold on to the writable paths: the private /tmp may hide them.
+	fds := make([]int, 0, len(s.writable))
+	for _, path := range s.writable {
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open writable path %s: %w", path, err)
+		}
+
+		fds = append(fds, fd)
+	}
+
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mounts {
+		if underAny(m.path, sandboxSkipped) {
+			continue
+		}
+
+		if err := unix.Mount("", m.path, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|m.flags, ""); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", m.path, err)
+		}
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount private /tmp: %w", err)
+	}
+
+	for i, path := range s.writable {
+		if err := bindWritable(fds[i], path, mounts); err != nil {
+			return fmt.Errorf("bind writable path %s: %w", path, err)
+		}
+
+		_ = unix.Close(fds[i])
+	}
+
+	// The old working directory lives on the read-only mount.
+	if err := os.Chdir(workDir); err != nil {
+		return fmt.Errorf("change to work dir: %w", err)
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("drop ambient capabilities: %w", err)
+	}
+
+	return nil
+}
+
+// bindWritable mounts the file or directory behind fd on path and makes the
+// new mount writable.
+func bindWritable(fd int, path string, mounts []mountPoint) error {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	// The target only needs to be created when it is hidden by /tmp.
+	if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			return err
+		}
+	}
+
+	source := "/proc/self/fd/" + strconv.Itoa(fd)
+	if err := unix.Mount(source, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind mount: %w", err)
+	}
+
+	flags := containingMount(mounts, path).flags
+	if err := unix.Mount("", path, "", unix.MS_REMOUNT|unix.MS_BIND|flags, ""); err != nil {
+		return fmt.Errorf("remount writable: %w", err)
+	}
+
+	return nil
+}
+
+// mountPoint is a mount from /proc/self/mountinfo with the per-mount flags
+// that must be kept when it is remounted.
+type mountPoint struct {
+	path  string
+	flags uintptr
+}
+
+var mountFlags = map[string]uintptr{
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+func readMounts() ([]mountPoint, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("read mounts: %w", err)
+	}
+	defer f.Close()
+
+	var mounts []mountPoint
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// ID parentID major:minor root mountPoint options ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		m := mountPoint{path: unescapeMountPath(fields[4])}
+		for _, opt := range strings.Split(fields[5], ",") {
+			m.flags |= mountFlags[opt]
+		}
+
+		mounts = append(mounts, m)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read mounts: %w", err)
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountPath decodes the octal escapes used in mountinfo for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountPath(path string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+
+				continue
+			}
+		}
+
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
+
+// containingMount returns the mount with the longest mount point containing
+// path.
+func containingMount(mounts []mountPoint, path string) mountPoint {
+	var best mountPoint
+
+	for _, m := range mounts {
+		if underAny(path, []string{m.path}) && len(m.path) >= len(best.path) {
+			best = m
+		}
+	}
+
+	return best
+}
+
+// underAny reports whether path is one of roots or inside one of them.
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || root == "/" || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,190 @@
+//go:build linux
+
+package ainvoke
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRunSandbox(t *testing.T) {
+	requireUserNamespaces(t)
+
+	runDir := t.TempDir()
+	outside, err := os.MkdirTemp(repoRoot(t), ".sandbox-probe-*")
+	if err != nil {
+		t.Fatalf("create outside dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(outside) })
+
+	writableDir := filepath.Join(outside, "writable")
+	if err := os.Mkdir(writableDir, 0o755); err != nil {
+		t.Fatalf("create writable dir: %v", err)
+	}
+
+	probe := "ainvoke-sandbox-probe-" + filepath.Base(runDir)
+	script := `
+if touch "` + outside + `/probe" 2>/dev/null; then echo yes > outside.txt; else echo no > outside.txt; fi
+touch "` + writableDir + `/probe"
+echo tmp > "/tmp/` + probe + `"
+grep -c : /proc/net/dev > net.txt
+printf '{"result":"ok"}' > output.json`
+	runner := newShellRunner(t, script)
+
+	for _, tty := range []bool{false, true} {
+		_, err := runner.Execute(
+			context.Background(),
+			helloInvocation(runDir, map[string]any{"name": "Ada"}),
+			WithTTY(tty),
+			WithSandbox(Sandbox{DisableNetwork: true, WritablePaths: []string{writableDir}}),
+		)
+		if err != nil {
+			t.Fatalf("execute (tty=%v): %v", tty, err)
+		}
+
+		if got := readTrimmed(t, filepath.Join(runDir, "outside.txt")); got != "no" {
+			t.Errorf("expected paths outside the run dir to be read-only (tty=%v)", tty)
+		}
+		if _, err := os.Stat(filepath.Join(writableDir, "probe")); err != nil {
+			t.Errorf("expected writable path to be writable (tty=%v): %v", tty, err)
+		}
+		if _, err := os.Stat(filepath.Join(os.TempDir(), probe)); err == nil {
+			t.Errorf("expected /tmp to be private (tty=%v)", tty)
+		}
+		if got := readTrimmed(t, filepath.Join(runDir, "net.txt")); got != "1" {
+			t.Errorf("expected only the loopback interface (tty=%v), got %s", tty, got)
+		}
+	}
+}
+
+func TestRunSandboxSeparateWorkDir(t *testing.T) {
+	requireUserNamespaces(t)
+
+	runDir := t.TempDir()
+	workDir := t.TempDir()
+
+	inv := helloInvocation(runDir, map[string]any{"name": "Ada"})
+	inv.WorkDir = workDir
+
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p'); echo edit > file.txt; printf '{"result":"ok"}' > "$out"`)
+
+	res, err := runner.Execute(context.Background(), inv, WithSandbox(Sandbox{}), WithResourceLimits(ResourceLimits{OpenFiles: 64}))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	if got := readTrimmed(t, filepath.Join(workDir, "file.txt")); got != "edit" {
+		t.Errorf("expected work dir to be writable, got %q", got)
+	}
+}
+
+// sandboxUserEnv marks a copy of the test binary re-executed as an
+// unprivileged user by TestRunSandboxUnprivileged.
+const sandboxUserEnv = "AINVOKE_TEST_SANDBOX_UNPRIVILEGED"
+
+func TestRunSandboxUnprivileged(t *testing.T) {
+	if os.Getuid() == 0 && os.Getenv(sandboxUserEnv) == "" {
+		runAsNobody(t, "TestRunSandboxUnprivileged")
+
+		return
+	}
+
+	requireUserNamespaces(t)
+
+	runDir := t.TempDir()
+	runner := newShellRunner(t, `id -u > uid.txt
+awk '/^CapEff/ { print $2 }' /proc/self/status > caps.txt
+printf '{"result":"ok"}' > output.json`)
+
+	for _, tty := range []bool{false, true} {
+		_, err := runner.Execute(
+			context.Background(),
+			helloInvocation(runDir, map[string]any{"name": "Ada"}),
+			WithTTY(tty),
+			WithSandbox(Sandbox{}),
+		)
+		if err != nil {
+			t.Fatalf("execute (tty=%v): %v", tty, err)
+		}
+
+		if got := readTrimmed(t, filepath.Join(runDir, "uid.txt")); got != strconv.Itoa(os.Getuid()) {
+			t.Errorf("expected the agent to keep uid %d (tty=%v), got %s", os.Getuid(), tty, got)
+		}
+		if got := readTrimmed(t, filepath.Join(runDir, "caps.txt")); got != "0000000000000000" {
+			t.Errorf("expected no effective capabilities (tty=%v), got %s", tty, got)
+		}
+	}
+}
+
+// runAsNobody runs test in a copy of the test binary as the nobody user and
+// reports its result.
+func runAsNobody(t *testing.T, test string) {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "ainvoke-test-*")
+	if err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatalf("chmod dir: %v", err)
+	}
+
+	data, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatalf("read test binary: %v", err)
+	}
+
+	exe := filepath.Join(dir, "ainvoke.test")
+	if err := os.WriteFile(exe, data, 0o755); err != nil {
+		t.Fatalf("copy test binary: %v", err)
+	}
+
+	cmd := exec.Command(exe, "-test.run=^"+test+"$", "-test.v")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), sandboxUserEnv+"=1", "HOME="+dir)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err != nil:
+		t.Fatalf("%s as nobody: %v\n%s", test, err, out)
+	case strings.Contains(string(out), "--- SKIP"):
+		t.Skipf("%s as nobody was skipped:\n%s", test, out)
+	}
+}
+
+func TestSandboxValidate(t *testing.T) {
+	if err := (Sandbox{WritablePaths: []string{"relative"}}).validate(); err == nil {
+		t.Fatal("expected error for relative writable path")
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/with\040space\134x`); got != `/mnt/with space\x` {
+		t.Fatalf("unexpected path %q", got)
+	}
+}
+
+func requireUserNamespaces(t *testing.T) {
+	t.Helper()
+
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+	}
+	if err := cmd.Run(); err != nil {
+		t.Skipf("user namespaces are not available: %v", err)
+	}
+}
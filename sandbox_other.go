@@ -0,0 +1,21 @@
+//go:build unix && !linux
+
+package ainvoke
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func configureSandbox(*exec.Cmd, Sandbox, []string) ([]string, error) {
+	return nil, errors.New("only supported on Linux")
+}
+
+type sandboxSetup struct {
+	enabled  bool
+	writable []string
+}
+
+func (sandboxSetup) setup() error {
+	return errors.New("only supported on Linux")
+}
@@ -0,0 +1,90 @@
+package ainvoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Schema is a compiled JSON schema. It is safe for concurrent use.
+type Schema struct {
+	text     string
+	compiled *gojsonschema.Schema
+}
+
+// CompileSchema parses and compiles text once so that it can be used to
+// validate many documents.
+func CompileSchema(text string) (*Schema, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(text))
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+
+	return &Schema{text: text, compiled: compiled}, nil
+}
+
+// String returns the schema text it was compiled from.
+func (s *Schema) String() string {
+	return s.text
+}
+
+// Validate checks data against the schema as agent output. Violations are
+// returned as a *ValidationError matching ErrOutputSchemaInvalid.
+func (s *Schema) Validate(data []byte) error {
+	return s.validate(data, ErrOutputSchemaInvalid)
+}
+
+// ValidateInput checks data against the schema as agent input. Violations
+// are returned as a *ValidationError matching ErrInputSchemaInvalid.
+func (s *Schema) ValidateInput(data []byte) error {
+	return s.validate(data, ErrInputSchemaInvalid)
+}
+
+func (s *Schema) validate(data []byte, sentinel error) error {
+	failures, err := s.violations(data)
+	if err != nil {
+		return err
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Failures: failures, sentinel: sentinel}
+}
+
+// violations returns one failure per violation. A document that is not valid
+// JSON is reported as a violation.
+func (s *Schema) violations(data []byte) ([]ValidationFailure, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []ValidationFailure{{Message: fmt.Sprintf("invalid JSON: %v", err)}}, nil
+	}
+
+	result, err := s.compiled.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]ValidationFailure, 0, len(result.Errors()))
+	for _, err := range result.Errors() {
+		failures = append(failures, validationFailure(err))
+	}
+
+	return failures, nil
+}
+
+// reuseSchema returns compiled when it was compiled from text, and compiles
+// text otherwise. An empty text gives a nil schema.
+func reuseSchema(compiled *Schema, text string) (*Schema, error) {
+	switch {
+	case strings.TrimSpace(text) == "":
+		return nil, nil
+	case compiled != nil && compiled.text == text:
+		return compiled, nil
+	default:
+		return CompileSchema(text)
+	}
+}
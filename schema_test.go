@@ -0,0 +1,102 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCompileSchema(t *testing.T) {
+	schema, err := CompileSchema(helloOutputSchema)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	if schema.String() != helloOutputSchema {
+		t.Fatalf("expected schema text to be kept, got %s", schema)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if err := schema.Validate([]byte(`{"result":"ok"}`)); err != nil {
+				t.Errorf("validate: %v", err)
+			}
+
+			err := schema.Validate([]byte(`{"result":1}`))
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrOutputSchemaInvalid) {
+				t.Errorf("expected ValidationError, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if err := schema.Validate([]byte(`{`)); !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected invalid JSON to be a violation, got %v", err)
+	}
+
+	for _, text := range []string{`{`, `{"type":"strin"}`, `{"required":"result"}`} {
+		if _, err := CompileSchema(text); err == nil {
+			t.Errorf("expected error for %s", text)
+		}
+	}
+}
+
+func TestReuseSchema(t *testing.T) {
+	compiled, err := CompileSchema(helloInputSchema)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	if got, err := reuseSchema(compiled, helloInputSchema); err != nil || got != compiled {
+		t.Fatalf("expected the compiled schema to be reused, got %v, %v", got, err)
+	}
+
+	other, err := reuseSchema(compiled, helloOutputSchema)
+	if err != nil || other == compiled || other.String() != helloOutputSchema {
+		t.Fatalf("expected a schema compiled from the new text, got %v, %v", other, err)
+	}
+
+	if got, err := reuseSchema(compiled, " "); err != nil || got != nil {
+		t.Fatalf("expected no schema for an empty text, got %v, %v", got, err)
+	}
+
+	if err := compiled.ValidateInput([]byte(`{"name":1}`)); !errors.Is(err, ErrInputSchemaInvalid) {
+		t.Fatalf("expected ErrInputSchemaInvalid, got %v", err)
+	}
+}
+
+func TestRunnerSchemas(t *testing.T) {
+	cmd := []string{"sh", "-c", `printf '{"result":"ok"}' > output.json`}
+
+	if _, err := NewRunner(AgentConfig{Cmd: cmd, OutputSchema: `{"type":"strin"}`}); err == nil {
+		t.Fatal("expected NewRunner to reject a malformed output schema")
+	}
+
+	if _, err := NewRunner(AgentConfig{Cmd: cmd, InputSchema: `{`}); err == nil {
+		t.Fatal("expected NewRunner to reject a malformed input schema")
+	}
+
+	runner, err := NewRunner(AgentConfig{Cmd: cmd, InputSchema: helloInputSchema, OutputSchema: helloOutputSchema})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	inv := Invocation{RunDir: t.TempDir(), Input: map[string]any{"name": "Ada"}}
+
+	res, err := runner.Execute(context.Background(), inv)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if string(res.Output) != `{"result":"ok"}` {
+		t.Fatalf("unexpected output %s", res.Output)
+	}
+
+	if got := readTrimmed(t, res.OutputSchemaPath); got != helloOutputSchema {
+		t.Fatalf("expected config output schema to be used, got %s", got)
+	}
+}
@@ -0,0 +1,500 @@
+package ainvoke
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaFor derives a JSON schema from the Go type T.
+//
+// Struct fields follow encoding/json naming: the json tag sets the property
+// name, "-" skips the field and embedded structs are flattened. A field is
+// required unless its json tag has omitempty or omitzero. The jsonschema tag
+// refines a field with comma-separated entries:
+//
+//	required, optional, title=..., description=..., enum=a|b|c, format=...,
+//	minimum=..., maximum=..., minLength=..., maxLength=..., pattern=...
+//
+// A literal comma inside a value is written as "\,". Long descriptions may use
+// a separate jsonschema_description tag instead.
+func SchemaFor[T any]() (string, error) {
+	return schemaForType(reflect.TypeFor[T]())
+}
+
+func schemaForType(t reflect.Type) (string, error) {
+	g := &schemaGenerator{
+		inProgress: make(map[reflect.Type]bool),
+		recursive:  make(map[reflect.Type]bool),
+		defs:       make(map[string]*schemaNode),
+	}
+
+	root, err := g.node(t)
+	if err != nil {
+		return "", err
+	}
+
+	if len(g.defs) > 0 {
+		root.Definitions = g.defs
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return "", fmt.Errorf("marshal schema: %w", err)
+	}
+
+	return string(data), nil
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+type schemaGenerator struct {
+	inProgress map[reflect.Type]bool
+	recursive  map[reflect.Type]bool
+	defs       map[string]*schemaNode
+}
+
+func (g *schemaGenerator) node(t reflect.Type) (*schemaNode, error) {
+	switch {
+	case t == timeType:
+		return &schemaNode{Type: "string", Format: "date-time"}, nil
+	case t == rawMessageType:
+		return &schemaNode{}, nil
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return &schemaNode{}, nil
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &schemaNode{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schemaNode{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schemaNode{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{Type: "number"}, nil
+	case reflect.String:
+		return &schemaNode{Type: "string"}, nil
+	case reflect.Interface:
+		return &schemaNode{}, nil
+	case reflect.Pointer:
+		return g.pointerNode(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schemaNode{Type: []string{"string", "null"}, ContentEncoding: "base64"}, nil
+		}
+
+		items, err := g.node(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		return &schemaNode{Type: []string{"array", "null"}, Items: items}, nil
+	case reflect.Array:
+		items, err := g.node(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		return &schemaNode{Type: "array", Items: items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String && !t.Key().Implements(textMarshalerType) {
+			return nil, fmt.Errorf("schema for %s: map keys must be strings", t)
+		}
+
+		values, err := g.node(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		return &schemaNode{Type: []string{"object", "null"}, AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return g.structRef(t)
+	default:
+		return nil, fmt.Errorf("schema for %s: unsupported kind %s", t, t.Kind())
+	}
+}
+
+// pointerNode allows null next to the pointed-to type, since a nil pointer
+// marshals as null. Slices and maps are nullable for the same reason. A
+// reference has no type to extend, so it becomes one branch of an anyOf;
+// otherwise a recursive pointer could never end.
+func (g *schemaGenerator) pointerNode(t reflect.Type) (*schemaNode, error) {
+	elem, err := g.node(t.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	if elem.Ref != "" {
+		return &schemaNode{AnyOf: []*schemaNode{elem, {Type: "null"}}}, nil
+	}
+
+	if typ, ok := elem.Type.(string); ok {
+		clone := *elem
+		clone.Type = []string{typ, "null"}
+
+		return &clone, nil
+	}
+
+	return elem, nil
+}
+
+// structRef inlines struct schemas. A struct that refers back to itself is
+// moved to definitions and referenced instead.
+func (g *schemaGenerator) structRef(t reflect.Type) (*schemaNode, error) {
+	if g.inProgress[t] {
+		g.recursive[t] = true
+
+		return &schemaNode{Ref: "#/definitions/" + definitionName(t)}, nil
+	}
+
+	g.inProgress[t] = true
+	defer delete(g.inProgress, t)
+
+	n, err := g.structNode(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if !g.recursive[t] {
+		return n, nil
+	}
+
+	g.defs[definitionName(t)] = n
+
+	return &schemaNode{Ref: "#/definitions/" + definitionName(t)}, nil
+}
+
+func definitionName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+
+	return strings.NewReplacer(" ", "", "{", "", "}", "", ";", "_").Replace(t.String())
+}
+
+func (g *schemaGenerator) structNode(t reflect.Type) (*schemaNode, error) {
+	n := &schemaNode{Type: "object"}
+
+	if err := g.addFields(n, t, false); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// addFields adds the fields of t to n. Fields promoted from an embedded struct
+// never replace a field declared on the outer struct, as with encoding/json.
+func (g *schemaGenerator) addFields(n *schemaNode, t reflect.Type, embedded bool) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		name, opts, skip := jsonFieldName(f)
+		if skip {
+			continue
+		}
+
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				// A struct embedding itself only repeats fields that the
+				// outer level already declares, as in encoding/json.
+				if g.inProgress[ft] {
+					continue
+				}
+
+				g.inProgress[ft] = true
+				err := g.addFields(n, ft, true)
+				delete(g.inProgress, ft)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if !f.IsExported() {
+				continue
+			}
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if embedded && n.Properties.has(name) {
+			continue
+		}
+
+		prop, err := g.node(ft)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		required := !opts.has("omitempty") && !opts.has("omitzero")
+
+		prop, required, err = applySchemaTag(prop, f, required)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		n.Properties = n.Properties.set(name, prop)
+		n.Required = slices.DeleteFunc(n.Required, func(r string) bool { return r == name })
+
+		if required {
+			n.Required = append(n.Required, name)
+		}
+	}
+
+	return nil
+}
+
+type tagOptions string
+
+func (o tagOptions) has(name string) bool {
+	for _, opt := range strings.Split(string(o), ",") {
+		if opt == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonFieldName mirrors encoding/json: it returns the tag name (empty when
+// unset), the remaining tag options and whether the field is skipped.
+func jsonFieldName(f reflect.StructField) (string, tagOptions, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", "", true
+	}
+
+	if !f.IsExported() && !f.Anonymous {
+		return "", "", true
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+
+	if f.Anonymous && name != "" && !f.IsExported() {
+		return "", "", true
+	}
+
+	return name, tagOptions(opts), false
+}
+
+// applySchemaTag applies the jsonschema and jsonschema_description tags.
+// Annotations on a $ref are wrapped in allOf so they do not hide the reference.
+func applySchemaTag(prop *schemaNode, f reflect.StructField, required bool) (*schemaNode, bool, error) {
+	entries := splitEscaped(f.Tag.Get("jsonschema"))
+	desc := f.Tag.Get("jsonschema_description")
+
+	if len(entries) == 0 && desc == "" {
+		return prop, required, nil
+	}
+
+	n := *prop
+	if n.Ref != "" {
+		n = schemaNode{AllOf: []*schemaNode{prop}}
+	}
+
+	if desc != "" {
+		n.Description = desc
+	}
+
+	for _, entry := range entries {
+		key, value, _ := strings.Cut(entry, "=")
+
+		switch key {
+		case "":
+			continue
+		case "required":
+			required = true
+		case "optional":
+			required = false
+		case "title":
+			n.Title = value
+		case "description":
+			n.Description = value
+		case "format":
+			n.Format = value
+		case "pattern":
+			n.Pattern = value
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				ev, err := enumValue(f.Type, v)
+				if err != nil {
+					return nil, false, err
+				}
+
+				n.Enum = append(n.Enum, ev)
+			}
+		case "minimum", "maximum":
+			num, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("jsonschema %s: %w", key, err)
+			}
+
+			if key == "minimum" {
+				n.Minimum = &num
+			} else {
+				n.Maximum = &num
+			}
+		case "minLength", "maxLength":
+			num, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, false, fmt.Errorf("jsonschema %s: %w", key, err)
+			}
+
+			if key == "minLength" {
+				n.MinLength = &num
+			} else {
+				n.MaxLength = &num
+			}
+		default:
+			return nil, false, fmt.Errorf("unknown jsonschema tag entry %q", key)
+		}
+	}
+
+	return &n, required, nil
+}
+
+func enumValue(t reflect.Type, v string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseInt(v, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return v, nil
+	}
+}
+
+// splitEscaped splits a tag value on commas that are not escaped as "\,".
+func splitEscaped(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var (
+		parts []string
+		cur   strings.Builder
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ',':
+			cur.WriteByte(',')
+			i++
+		case s[i] == ',':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+
+	return append(parts, cur.String())
+}
+
+// schemaNode is the subset of JSON schema emitted by SchemaFor. Field order
+// keeps the generated schema readable in prompts.
+type schemaNode struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 any                    `json:"type,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Enum                 []any                  `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Items                *schemaNode            `json:"items,omitempty"`
+	Properties           orderedProperties      `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *schemaNode            `json:"additionalProperties,omitempty"`
+	AllOf                []*schemaNode          `json:"allOf,omitempty"`
+	AnyOf                []*schemaNode          `json:"anyOf,omitempty"`
+	Definitions          map[string]*schemaNode `json:"definitions,omitempty"`
+}
+
+type schemaProperty struct {
+	name   string
+	schema *schemaNode
+}
+
+// orderedProperties keeps properties in struct field order.
+type orderedProperties []schemaProperty
+
+func (p orderedProperties) has(name string) bool {
+	return slices.ContainsFunc(p, func(prop schemaProperty) bool { return prop.name == name })
+}
+
+// set adds or replaces a property; a later field shadows an embedded one.
+func (p orderedProperties) set(name string, schema *schemaNode) orderedProperties {
+	for i := range p {
+		if p[i].name == name {
+			p[i].schema = schema
+
+			return p
+		}
+	}
+
+	return append(p, schemaProperty{name: name, schema: schema})
+}
+
+func (p orderedProperties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i, prop := range p {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, err := json.Marshal(prop.name)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(prop.schema)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+package ainvoke
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaSample struct {
+	schemaBase
+
+	Name     string            `json:"name"                jsonschema:"description=Display name\\, in full"`
+	Kind     string            `json:"kind"                jsonschema:"enum=a|b"`
+	Count    int               `json:"count,omitempty"     jsonschema:"minimum=1"`
+	Score    float64           `json:"score,omitempty"     jsonschema:"required"`
+	Tags     []string          `json:"tags"                jsonschema:"optional"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Note     *string           `json:"note"`
+	When     time.Time         `json:"when"`
+	Skipped  string            `json:"-"`
+	internal string
+}
+
+type schemaTree struct {
+	Value    string        `json:"value"`
+	Children []*schemaTree `json:"children,omitempty"`
+}
+
+func TestSchemaForStruct(t *testing.T) {
+	schema, err := SchemaFor[schemaSample]()
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(schema), &got); err != nil {
+		t.Fatalf("unmarshal schema: %v", err)
+	}
+
+	props := got["properties"].(map[string]any)
+	for _, name := range []string{"id", "name", "kind", "count", "score", "tags", "labels", "note", "when"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("missing property %q in %s", name, schema)
+		}
+	}
+	for _, name := range []string{"Skipped", "internal", "schemaBase"} {
+		if _, ok := props[name]; ok {
+			t.Errorf("unexpected property %q in %s", name, schema)
+		}
+	}
+
+	wantRequired := []any{"id", "name", "kind", "score", "note", "when"}
+	if !reflect.DeepEqual(got["required"], wantRequired) {
+		t.Errorf("required = %v, want %v", got["required"], wantRequired)
+	}
+
+	name := props["name"].(map[string]any)
+	if name["description"] != "Display name, in full" {
+		t.Errorf("unexpected description %v", name["description"])
+	}
+
+	kind := props["kind"].(map[string]any)
+	if !reflect.DeepEqual(kind["enum"], []any{"a", "b"}) {
+		t.Errorf("unexpected enum %v", kind["enum"])
+	}
+
+	note := props["note"].(map[string]any)
+	if !reflect.DeepEqual(note["type"], []any{"string", "null"}) {
+		t.Errorf("unexpected pointer type %v", note["type"])
+	}
+
+	when := props["when"].(map[string]any)
+	if when["format"] != "date-time" {
+		t.Errorf("unexpected time format %v", when["format"])
+	}
+}
+
+func TestSchemaForValidatesValues(t *testing.T) {
+	schema, err := SchemaFor[schemaSample]()
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	valid, err := json.Marshal(schemaSample{
+		schemaBase: schemaBase{ID: "1"},
+		Name:       "Ada",
+		Kind:       "a",
+		Score:      1,
+		When:       time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(schema), gojsonschema.NewBytesLoader(valid))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !result.Valid() {
+		t.Fatalf("expected marshaled value to be valid, got %v", result.Errors())
+	}
+
+	result, err = gojsonschema.Validate(
+		gojsonschema.NewStringLoader(schema),
+		gojsonschema.NewStringLoader(`{"id":"1","name":"Ada","kind":"c","score":1,"note":null,"when":"2024-01-01T00:00:00Z"}`),
+	)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if result.Valid() {
+		t.Fatal("expected enum violation")
+	}
+}
+
+func TestSchemaForRecursive(t *testing.T) {
+	schema, err := SchemaFor[schemaTree]()
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewStringLoader(schema),
+		gojsonschema.NewStringLoader(`{"value":"root","children":[{"value":"leaf"}]}`),
+	)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !result.Valid() {
+		t.Fatalf("expected valid tree, got %v", result.Errors())
+	}
+}
+
+type selfEmbedding struct {
+	*selfEmbedding
+
+	Name string `json:"name"`
+}
+
+func TestSchemaForSelfEmbedding(t *testing.T) {
+	schema, err := SchemaFor[selfEmbedding]()
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	if want := `{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`; schema != want {
+		t.Fatalf("schema = %s, want %s", schema, want)
+	}
+
+	data, err := json.Marshal(selfEmbedding{Name: "a"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	if err := validateOutput(schema, data); err != nil {
+		t.Fatalf("expected %s to be valid: %v", data, err)
+	}
+}
+
+func TestSchemaForScalarsAndErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{name: "string", schema: SchemaFor[string], want: `{"type":"string"}`},
+		{name: "int slice", schema: SchemaFor[[]int], want: `{"type":["array","null"],"items":{"type":"integer"}}`},
+		{name: "bytes", schema: SchemaFor[[]byte], want: `{"type":["string","null"],"contentEncoding":"base64"}`},
+		{name: "array", schema: SchemaFor[[2]bool], want: `{"type":"array","items":{"type":"boolean"}}`},
+		{name: "any", schema: SchemaFor[any], want: `{}`},
+		{name: "int keyed map", schema: SchemaFor[map[int]string], wantErr: true},
+		{name: "channel", schema: SchemaFor[chan int], wantErr: true},
+		{name: "bad tag", schema: SchemaFor[struct {
+			A string `json:"a" jsonschema:"bogus"`
+		}], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.schema()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("schema = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
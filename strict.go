@@ -0,0 +1,361 @@
+package ainvoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// OptionalKeyword marks a property schema as optional in strict mode, e.g.
+// {"type":"string","x-optional":true}.
+const OptionalKeyword = "x-optional"
+
+// StrictSchema returns schema with every object schema closed and its
+// properties required, as used by WithStrictSchema:
+//
+//   - object schemas without additionalProperties get
+//     "additionalProperties": false;
+//   - every property is added to required unless its schema has
+//     "x-optional": true;
+//   - a format without a registered checker is rejected with
+//     ErrUnknownFormat.
+//
+// Nested schemas, including definitions and combinators, are transformed too.
+// allOf, anyOf and oneOf branches, and the definitions they reference, are
+// not closed themselves: the schema holding them is, with their properties.
+func StrictSchema(schema string) (string, error) {
+	var root any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return "", fmt.Errorf("parse schema: %w", err)
+	}
+
+	w := strictWalker{root: root, open: make(map[string]bool)}
+	w.findBranchRefs(root)
+
+	if err := w.node(root, "", true); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal schema: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// strictInvocation replaces the schemas of inv with their strict versions.
+// Empty schemas are left for validation to report.
+func strictInvocation(inv *Invocation) error {
+	for _, schema := range []*string{&inv.InputSchema, &inv.OutputSchema} {
+		if strings.TrimSpace(*schema) == "" {
+			continue
+		}
+
+		strict, err := StrictSchema(*schema)
+		if err != nil {
+			return err
+		}
+
+		*schema = strict
+	}
+
+	return nil
+}
+
+// strictSubschemas lists the keywords whose value is a schema, an array of
+// schemas or a map of schemas.
+var strictSubschemas = []string{
+	"items", "additionalItems", "contains", "prefixItems", "not",
+	"if", "then", "else", "allOf", "anyOf", "oneOf",
+	"properties", "patternProperties", "definitions", "$defs", "dependencies",
+}
+
+// combinators list the keywords whose branches describe the same object as
+// the schema holding them.
+var combinators = []string{"allOf", "anyOf", "oneOf"}
+
+// strictWalker closes the object schemas of root. An object split across
+// combinator branches is closed once, on the schema holding the combinator,
+// with the properties of all branches: closing each branch would make it
+// reject the properties of the others.
+type strictWalker struct {
+	root any
+	// open holds the local references used as combinator branches. Their
+	// targets are branches too and are not closed.
+	open map[string]bool
+}
+
+// findBranchRefs records the local $refs used as combinator branches.
+func (w *strictWalker) findBranchRefs(node any) {
+	switch node := node.(type) {
+	case map[string]any:
+		for _, keyword := range combinators {
+			branches, _ := node[keyword].([]any)
+			for _, branch := range branches {
+				branch, _ := branch.(map[string]any)
+				if ref, ok := branch["$ref"].(string); ok && strings.HasPrefix(ref, "#") {
+					w.open[ref] = true
+				}
+			}
+		}
+
+		for _, value := range node {
+			w.findBranchRefs(value)
+		}
+	case []any:
+		for _, value := range node {
+			w.findBranchRefs(value)
+		}
+	}
+}
+
+// node makes schema strict. closable is false for combinator branches, whose
+// properties are required but not closed.
+func (w *strictWalker) node(node any, pointer string, closable bool) error {
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	if format, ok := schema["format"].(string); ok && !gojsonschema.FormatCheckers.Has(format) {
+		return fmt.Errorf("%w %q at %s", ErrUnknownFormat, format, pointerOrRoot(pointer))
+	}
+
+	closable = closable && !w.open["#"+pointer]
+
+	allOf, alternatives := w.branchProperties(schema, true), w.branchProperties(schema, false)
+
+	switch {
+	case closable && (isObjectSchema(schema) || len(alternatives) > 0):
+		closeObject(schema, allOf, alternatives)
+	case isObjectSchema(schema):
+		requireProperties(schema)
+	}
+
+	if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+		if err := w.node(additional, pointer+"/additionalProperties", true); err != nil {
+			return err
+		}
+	}
+
+	for _, keyword := range strictSubschemas {
+		switch value := schema[keyword].(type) {
+		case []any:
+			branch := slices.Contains(combinators, keyword)
+
+			for i, item := range value {
+				if err := w.node(item, fmt.Sprintf("%s/%s/%d", pointer, keyword, i), !branch); err != nil {
+					return err
+				}
+			}
+		case map[string]any:
+			if !isSchemaMap(keyword) {
+				if err := w.node(value, pointer+"/"+keyword, true); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			for name, item := range value {
+				if err := w.node(item, pointer+"/"+keyword+"/"+name, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// branchProperties returns the properties declared in the combinator
+// branches of schema, following local references and nested combinators.
+// With allOfOnly, only the branches that always apply are included;
+// otherwise allOf, anyOf and oneOf all are.
+func (w *strictWalker) branchProperties(schema map[string]any, allOfOnly bool) map[string]any {
+	found := make(map[string]any)
+	w.collectBranchProperties(schema, allOfOnly, found, make(map[string]bool))
+
+	return found
+}
+
+func (w *strictWalker) collectBranchProperties(
+	schema map[string]any,
+	allOfOnly bool,
+	found map[string]any,
+	seen map[string]bool,
+) {
+	for _, keyword := range combinators {
+		if allOfOnly && keyword != "allOf" {
+			continue
+		}
+
+		branches, _ := schema[keyword].([]any)
+		for _, branch := range branches {
+			branch, _ := branch.(map[string]any)
+
+			if ref, ok := branch["$ref"].(string); ok {
+				if seen[ref] {
+					continue
+				}
+
+				seen[ref] = true
+				branch = w.resolve(ref)
+			}
+
+			properties, _ := branch["properties"].(map[string]any)
+			for name, property := range properties {
+				if _, ok := found[name]; !ok {
+					found[name] = property
+				}
+			}
+
+			w.collectBranchProperties(branch, allOfOnly, found, seen)
+		}
+	}
+}
+
+// resolve returns the schema a local reference such as "#/definitions/x"
+// points to, or nil.
+func (w *strictWalker) resolve(ref string) map[string]any {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil
+	}
+
+	node := w.root
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch n := node.(type) {
+		case map[string]any:
+			node = n[token]
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil
+			}
+
+			node = n[i]
+		default:
+			return nil
+		}
+	}
+
+	schema, _ := node.(map[string]any)
+
+	return schema
+}
+
+func isSchemaMap(keyword string) bool {
+	switch keyword {
+	case "properties", "patternProperties", "definitions", "$defs", "dependencies":
+		return true
+	default:
+		return false
+	}
+}
+
+func isObjectSchema(schema map[string]any) bool {
+	if _, ok := schema["properties"]; ok {
+		return true
+	}
+
+	switch t := schema["type"].(type) {
+	case string:
+		return t == "object"
+	case []any:
+		return slices.Contains(t, any("object"))
+	default:
+		return false
+	}
+}
+
+// closeObject forbids unknown properties unless the schema says otherwise and
+// requires every property not marked with OptionalKeyword. The properties of
+// allOf branches are merged into schema and required like its own; those of
+// anyOf and oneOf branches are only allowed, since the branch decides.
+func closeObject(schema, allOf, alternatives map[string]any) {
+	if _, ok := schema["additionalProperties"]; !ok {
+		schema["additionalProperties"] = false
+	}
+
+	if len(allOf) > 0 || len(alternatives) > 0 {
+		properties, _ := schema["properties"].(map[string]any)
+		if properties == nil {
+			properties = make(map[string]any)
+		}
+
+		for name, property := range allOf {
+			if _, ok := properties[name]; !ok {
+				properties[name] = property
+			}
+		}
+
+		schema["properties"] = properties
+		requireProperties(schema)
+
+		for name := range alternatives {
+			if _, ok := properties[name]; !ok {
+				properties[name] = map[string]any{}
+			}
+		}
+
+		return
+	}
+
+	requireProperties(schema)
+}
+
+// requireProperties adds every property not marked with OptionalKeyword to
+// required, keeping the existing order and sorting the added names.
+func requireProperties(schema map[string]any) {
+	properties, _ := schema["properties"].(map[string]any)
+	if len(properties) == 0 {
+		return
+	}
+
+	var required []string
+
+	if existing, ok := schema["required"].([]any); ok {
+		for _, name := range existing {
+			if name, ok := name.(string); ok {
+				required = append(required, name)
+			}
+		}
+	}
+
+	var added []string
+
+	for name, property := range properties {
+		property, _ := property.(map[string]any)
+		if optional, _ := property[OptionalKeyword].(bool); optional {
+			continue
+		}
+
+		if !slices.Contains(required, name) {
+			added = append(added, name)
+		}
+	}
+
+	slices.Sort(added)
+	schema["required"] = append(required, added...)
+}
+
+func pointerOrRoot(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+
+	return pointer
+}
@@ -0,0 +1,151 @@
+package ainvoke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "closes object",
+			schema: `{"type":"object","properties":{"b":{"type":"string"},"a":{"type":"string"}}}`,
+			want: `{"type":"object","additionalProperties":false,"required":["a","b"],` +
+				`"properties":{"a":{"type":"string"},"b":{"type":"string"}}}`,
+		},
+		{
+			name: "optional and existing required",
+			schema: `{"type":"object","required":["z"],"properties":{` +
+				`"z":{"type":"string"},"a":{"type":"string"},"note":{"type":"string","x-optional":true}}}`,
+			want: `{"type":"object","additionalProperties":false,"required":["z","a"],"properties":{` +
+				`"z":{"type":"string"},"a":{"type":"string"},"note":{"type":"string","x-optional":true}}}`,
+		},
+		{
+			name:   "explicit additional properties kept",
+			schema: `{"type":"object","additionalProperties":{"type":"object","properties":{"n":{}}}}`,
+			want: `{"type":"object","additionalProperties":{"type":"object","additionalProperties":false,` +
+				`"required":["n"],"properties":{"n":{}}}}`,
+		},
+		{
+			name: "nested",
+			schema: `{"type":"array","items":{"anyOf":[{"type":["object","null"],"properties":{"x":{}}}]},` +
+				`"definitions":{"d":{"type":"object"}}}`,
+			want: `{"type":"array","items":{"anyOf":[{"type":["object","null"],"required":["x"],"properties":{"x":{}}}],` +
+				`"additionalProperties":false,"properties":{"x":{}}},` +
+				`"definitions":{"d":{"type":"object","additionalProperties":false}}}`,
+		},
+		{
+			name: "allOf merged into parent",
+			schema: `{"allOf":[{"$ref":"#/definitions/base"},{"type":"object","properties":{"b":{}}}],` +
+				`"definitions":{"base":{"type":"object","properties":{"a":{}}}}}`,
+			want: `{"allOf":[{"$ref":"#/definitions/base"},{"type":"object","required":["b"],"properties":{"b":{}}}],` +
+				`"additionalProperties":false,"required":["a","b"],"properties":{"a":{},"b":{}},` +
+				`"definitions":{"base":{"type":"object","required":["a"],"properties":{"a":{}}}}}`,
+		},
+		{name: "scalar", schema: `{"type":"string","format":"email"}`, want: `{"type":"string","format":"email"}`},
+		{
+			name:    "unknown format",
+			schema:  `{"type":"object","properties":{"id":{"type":"string","format":"snowflake"}}}`,
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StrictSchema(tt.schema)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("strict schema: %v", err)
+			}
+
+			var gotValue, wantValue any
+			if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+				t.Fatalf("parse result: %v", err)
+			}
+
+			if err := json.Unmarshal([]byte(tt.want), &wantValue); err != nil {
+				t.Fatalf("parse want: %v", err)
+			}
+
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := StrictSchema(`{`); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
+
+func TestStrictSchemaAllOf(t *testing.T) {
+	schema, err := StrictSchema(`{"allOf":[` +
+		`{"type":"object","properties":{"name":{"type":"string"}}},` +
+		`{"type":"object","properties":{"age":{"type":"integer"},"note":{"type":"string","x-optional":true}}}]}`)
+	if err != nil {
+		t.Fatalf("strict schema: %v", err)
+	}
+
+	valid := []string{`{"name":"Ada","age":36}`, `{"name":"Ada","age":36,"note":"x"}`}
+	for _, doc := range valid {
+		if err := validateOutput(schema, []byte(doc)); err != nil {
+			t.Errorf("expected %s to be valid, got %v", doc, err)
+		}
+	}
+
+	invalid := []string{`{"name":"Ada"}`, `{"name":"Ada","age":36,"extra":true}`}
+	for _, doc := range invalid {
+		if err := validateOutput(schema, []byte(doc)); !errors.Is(err, ErrOutputSchemaInvalid) {
+			t.Errorf("expected %s to be invalid, got %v", doc, err)
+		}
+	}
+}
+
+func TestRunStrictSchema(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"result":"ok","extra":true}' > output.json`)
+
+	if _, err := Execute(context.Background(), runner, helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})); err != nil {
+		t.Fatalf("expected extra field to pass without strict mode: %v", err)
+	}
+
+	res, err := Execute(
+		context.Background(),
+		runner,
+		helloInvocation(t.TempDir(), map[string]any{"name": "Ada"}),
+		WithStrictSchema(true),
+	)
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+
+	if !strings.Contains(res.Prompt, `"additionalProperties": false`) {
+		t.Fatalf("expected strict output schema in prompt, got:\n%s", res.Prompt)
+	}
+
+	if schema := readTrimmed(t, res.OutputSchemaPath); !strings.Contains(schema, `"additionalProperties": false`) {
+		t.Fatalf("expected strict schema file, got %s", schema)
+	}
+
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+	inv.InputSchema = `{"type":"object","properties":{"name":{"type":"string","format":"person"}}}`
+
+	if _, err := Execute(context.Background(), runner, inv, WithStrictSchema(true)); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
@@ -16,7 +16,7 @@ type output struct {
 }
 
 func main() {
-	data, err := os.ReadFile("input.json")
+	data, err := os.ReadFile(envPath("AINVOKE_INPUT_PATH", "input.json"))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -32,8 +32,17 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	if err := os.WriteFile("output.json", encoded, 0o644); err != nil {
+	if err := os.WriteFile(envPath("AINVOKE_OUTPUT_PATH", "output.json"), encoded, 0o644); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
+
+// envPath returns the path exported by the runner in name, or fallback
+// relative to the working directory when the variable is not set.
+func envPath(name, fallback string) string {
+	if path := os.Getenv(name); path != "" {
+		return path
+	}
+	return fallback
+}
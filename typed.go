@@ -0,0 +1,65 @@
+package ainvoke
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Run invokes the agent with a typed input and decodes its output into Out.
+//
+// input replaces inv.Input. When inv.InputSchema or inv.OutputSchema is empty
+// it is derived from In or Out with SchemaFor. The output is decoded only after
+// it has passed schema validation. A ResultRunner validates the output itself;
+// for runners that only implement Runner the validation is done here.
+func Run[In, Out any](
+	ctx context.Context,
+	r Runner,
+	inv Invocation,
+	input In,
+	opts ...RunOption,
+) (Out, error) {
+	var out Out
+
+	inv.Input = input
+
+	if strings.TrimSpace(inv.InputSchema) == "" {
+		schema, err := SchemaFor[In]()
+		if err != nil {
+			return out, fmt.Errorf("input schema: %w", err)
+		}
+
+		inv.InputSchema = schema
+	}
+
+	if strings.TrimSpace(inv.OutputSchema) == "" {
+		schema, err := SchemaFor[Out]()
+		if err != nil {
+			return out, fmt.Errorf("output schema: %w", err)
+		}
+
+		inv.OutputSchema = schema
+	}
+
+	res, err := Execute(ctx, r, inv, opts...)
+	if err != nil {
+		return out, err
+	}
+
+	if res.Output == nil {
+		return out, newRunError(PhaseOutputMissing, res, fmt.Errorf("%w: %s", ErrMissingOutput, res.OutputPath))
+	}
+
+	if _, ok := r.(ResultRunner); !ok {
+		if err := validateOutput(inv.OutputSchema, res.Output); err != nil {
+			return out, newRunError(PhaseOutputValidation, res, fmt.Errorf("validate output: %w", err))
+		}
+	}
+
+	if err := json.Unmarshal(res.Output, &out); err != nil {
+		return out, fmt.Errorf("decode output: %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package ainvoke
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type greetInput struct {
+	Name string `json:"name"`
+}
+
+type greetOutput struct {
+	Result string `json:"result" jsonschema:"description=The greeting"`
+}
+
+func TestRunTyped(t *testing.T) {
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p')
+name=$(sed -n 's/.*"name":"\([^"]*\)".*/\1/p' input.json)
+printf '{"result":"Hello, %s!"}' "$name" > "$out"`)
+
+	got, err := Run[greetInput, greetOutput](
+		context.Background(),
+		runner,
+		Invocation{RunDir: t.TempDir()},
+		greetInput{Name: "Ada"},
+	)
+	if err != nil {
+		t.Fatalf("typed run: %v", err)
+	}
+	if got.Result != "Hello, Ada!" {
+		t.Fatalf("unexpected result %q", got.Result)
+	}
+}
+
+func TestRunTypedRejectsInvalidOutput(t *testing.T) {
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p'); printf '{"result":7}' > "$out"`)
+
+	_, err := Run[greetInput, greetOutput](
+		context.Background(),
+		runner,
+		Invocation{RunDir: t.TempDir()},
+		greetInput{Name: "Ada"},
+	)
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+}
+
+type linkedNode struct {
+	Name string      `json:"name"`
+	Next *linkedNode `json:"next"`
+}
+
+func TestRunTypedRecursive(t *testing.T) {
+	runner := newShellRunner(t, `out=$(sed -n 's/^- Write output JSON to: //p'); cp input.json "$out"`)
+
+	in := linkedNode{Name: "head", Next: &linkedNode{Name: "tail"}}
+
+	got, err := Run[linkedNode, linkedNode](context.Background(), runner, Invocation{RunDir: t.TempDir()}, in)
+	if err != nil {
+		t.Fatalf("typed run: %v", err)
+	}
+
+	if got.Name != "head" || got.Next == nil || got.Next.Name != "tail" || got.Next.Next != nil {
+		t.Fatalf("unexpected result %+v", got)
+	}
+
+	if _, err := Run[linkedNode, linkedNode](
+		context.Background(),
+		runner,
+		Invocation{RunDir: t.TempDir()},
+		linkedNode{},
+	); err != nil {
+		t.Fatalf("typed run with a nil pointer: %v", err)
+	}
+}
+
+type fileOnlyRunner struct{}
+
+func (fileOnlyRunner) Run(context.Context, Invocation, ...RunOption) ([]byte, []byte, int, error) {
+	return nil, nil, 0, nil
+}
+
+func TestRunTypedValidatesRunnerOutput(t *testing.T) {
+	runDir := t.TempDir()
+	writeFile(t, runDir, OutputFileName, `{"result":1}`)
+
+	_, err := Run[greetInput, greetOutput](
+		context.Background(),
+		fileOnlyRunner{},
+		Invocation{RunDir: runDir},
+		greetInput{Name: "Ada"},
+	)
+	if !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected ErrOutputSchemaInvalid, got %v", err)
+	}
+
+	writeFile(t, runDir, OutputFileName, `{"result":"ok"}`)
+
+	got, err := Run[greetInput, greetOutput](
+		context.Background(),
+		fileOnlyRunner{},
+		Invocation{RunDir: runDir},
+		greetInput{Name: "Ada"},
+	)
+	if err != nil {
+		t.Fatalf("typed run: %v", err)
+	}
+	if got.Result != "ok" {
+		t.Fatalf("unexpected result %q", got.Result)
+	}
+}
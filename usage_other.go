@@ -0,0 +1,9 @@
+//go:build !unix
+
+package ainvoke
+
+import "os"
+
+func processUsage(*os.ProcessState) *Usage {
+	return nil
+}
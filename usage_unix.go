@@ -0,0 +1,35 @@
+//go:build unix
+
+package ainvoke
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+func processUsage(state *os.ProcessState) *Usage {
+	if state == nil {
+		return nil
+	}
+
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return nil
+	}
+
+	// ru_maxrss is in bytes on Darwin and in kilobytes elsewhere.
+	maxRSS := int64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		maxRSS *= 1024
+	}
+
+	return &Usage{
+		UserTime:                   time.Duration(rusage.Utime.Nano()),
+		SystemTime:                 time.Duration(rusage.Stime.Nano()),
+		MaxRSS:                     maxRSS,
+		VoluntaryContextSwitches:   int64(rusage.Nvcsw),
+		InvoluntaryContextSwitches: int64(rusage.Nivcsw),
+	}
+}
@@ -0,0 +1,122 @@
+package ainvoke
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Validator checks agent output beyond what the output schema can express.
+// Validators set with WithValidators run in order after the output passed
+// schema validation.
+type Validator interface {
+	// Name identifies the validator. It is the Keyword of failures that do not
+	// set one.
+	Name() string
+	// Validate returns the problems found in output. inv carries the resolved
+	// run and work directories and the input. A returned error aborts the run
+	// instead of asking the agent for a repair.
+	Validate(ctx context.Context, inv Invocation, output []byte) ([]ValidationFailure, error)
+}
+
+// NewValidator returns a Validator named name that applies fn.
+func NewValidator(
+	name string,
+	fn func(ctx context.Context, inv Invocation, output []byte) ([]ValidationFailure, error),
+) Validator {
+	return validatorFunc{name: name, fn: fn}
+}
+
+type validatorFunc struct {
+	name string
+	fn   func(ctx context.Context, inv Invocation, output []byte) ([]ValidationFailure, error)
+}
+
+func (v validatorFunc) Name() string { return v.name }
+
+func (v validatorFunc) Validate(ctx context.Context, inv Invocation, output []byte) ([]ValidationFailure, error) {
+	return v.fn(ctx, inv, output)
+}
+
+// runValidators runs validators on output and returns a *ValidationError
+// matching ErrOutputRejected with all their failures.
+func runValidators(ctx context.Context, inv Invocation, output []byte, validators []Validator) error {
+	var failures []ValidationFailure
+
+	for _, v := range validators {
+		found, err := v.Validate(ctx, inv, output)
+		if err != nil {
+			return fmt.Errorf("validator %s: %w", v.Name(), err)
+		}
+
+		for _, f := range found {
+			if f.Keyword == "" {
+				f.Keyword = v.Name()
+			}
+
+			failures = append(failures, f)
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Failures: failures, sentinel: ErrOutputRejected}
+}
+
+// RegisterFormat adds a checker for the JSON schema "format" named name, used
+// by every schema and accepted by WithStrictSchema. Values that are not
+// strings are not checked. Failures are reported like other schema
+// violations, with the "format" keyword. The registry is process-global: a
+// format registered here, or replaced under an existing name, applies to
+// every schema in the program, including those of other packages using
+// gojsonschema. Register formats during program initialization.
+func RegisterFormat(name string, check func(value string) bool) {
+	gojsonschema.FormatCheckers.Add(name, stringFormat(check))
+}
+
+type stringFormat func(value string) bool
+
+func (f stringFormat) IsFormat(input any) bool {
+	s, ok := input.(string)
+	if !ok {
+		return true
+	}
+
+	return f(s)
+}
+
+// semverPattern is the regular expression suggested by semver.org.
+var semverPattern = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// SemverFormat reports whether value is a semantic version such as
+// "1.2.3-rc.1". It is the checker RegisterBuiltinFormats uses for "semver".
+func SemverFormat(value string) bool {
+	return semverPattern.MatchString(value)
+}
+
+// RepoPathFormat reports whether value is a clean, relative, slash-separated
+// path that stays inside the directory it is relative to. It is the checker
+// RegisterBuiltinFormats uses for "repo-path".
+func RepoPathFormat(value string) bool {
+	if value == "" || strings.Contains(value, `\`) || path.IsAbs(value) {
+		return false
+	}
+
+	return path.Clean(value) == value && value != ".." && !strings.HasPrefix(value, "../")
+}
+
+// RegisterBuiltinFormats registers SemverFormat as "semver" and
+// RepoPathFormat as "repo-path" with RegisterFormat. Importing the package
+// registers nothing, so programs opt in, typically at the start of main.
+func RegisterBuiltinFormats() {
+	RegisterFormat("semver", SemverFormat)
+	RegisterFormat("repo-path", RepoPathFormat)
+}
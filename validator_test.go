@@ -0,0 +1,182 @@
+package ainvoke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// citationValidator rejects citations of files missing from the workspace.
+var citationValidator = NewValidator(
+	"citations",
+	func(_ context.Context, inv Invocation, output []byte) ([]ValidationFailure, error) {
+		var out struct {
+			Citations []string `json:"citations"`
+		}
+		if err := json.Unmarshal(output, &out); err != nil {
+			return nil, err
+		}
+
+		var failures []ValidationFailure
+
+		for i, citation := range out.Citations {
+			if _, err := os.Stat(filepath.Join(inv.WorkDir, citation)); err != nil {
+				failures = append(failures, ValidationFailure{
+					Pointer: fmt.Sprintf("/citations/%d", i),
+					Message: "cited file does not exist: " + citation,
+				})
+			}
+		}
+
+		return failures, nil
+	},
+)
+
+const citationSchema = `{
+  "type":"object",
+  "properties":{"citations":{"type":"array","items":{"type":"string","format":"repo-path"}}},
+  "required":["citations"]
+}`
+
+func TestRunValidators(t *testing.T) {
+	runner := newShellRunner(t, `printf '{"citations":["main.go","missing.go"]}' > "$AINVOKE_OUTPUT_PATH"`)
+
+	workDir := t.TempDir()
+	writeFile(t, workDir, "main.go", "package main")
+
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+	inv.WorkDir = workDir
+	inv.OutputSchema = citationSchema
+
+	res, err := Execute(context.Background(), runner, inv, WithValidators(citationValidator))
+	if !errors.Is(err, ErrOutputRejected) {
+		t.Fatalf("expected ErrOutputRejected, got %v", err)
+	}
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Phase != PhaseOutputValidation {
+		t.Fatalf("expected output validation RunError, got %v", err)
+	}
+
+	want := ValidationFailure{Pointer: "/citations/1", Keyword: "citations", Message: "cited file does not exist: missing.go"}
+	if len(runErr.Failures) != 1 || runErr.Failures[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, runErr.Failures)
+	}
+
+	if len(res.Attempts) != 1 || !strings.Contains(res.Attempts[0].Errors[0], "missing.go") {
+		t.Fatalf("expected the failure in the attempt, got %+v", res.Attempts)
+	}
+
+	writeFile(t, workDir, "missing.go", "package main")
+
+	if _, err := Execute(context.Background(), runner, inv, WithValidators(citationValidator)); err != nil {
+		t.Fatalf("expected validators to pass, got %v", err)
+	}
+
+	broken := NewValidator("broken", func(context.Context, Invocation, []byte) ([]ValidationFailure, error) {
+		return nil, errors.New("boom")
+	})
+
+	_, err = Execute(context.Background(), runner, inv, WithValidators(broken), WithRepairAttempts(1))
+	if err == nil || errors.Is(err, ErrOutputRejected) || !strings.Contains(err.Error(), "validator broken: boom") {
+		t.Fatalf("expected validator error, got %v", err)
+	}
+
+	if _, err := Execute(context.Background(), runner, inv, WithValidators(nil)); err == nil {
+		t.Fatal("expected error for nil validator")
+	}
+}
+
+func TestRunValidatorRepair(t *testing.T) {
+	script := `if grep -q "total must equal" prompt.md; then
+  printf '{"items":[1,2],"total":3}' > output.json
+else
+  printf '{"items":[1,2],"total":4}' > output.json
+fi`
+
+	runner, err := NewRunner(AgentConfig{Cmd: []string{"sh", "-c", script}, PromptDelivery: PromptFile})
+	if err != nil {
+		t.Fatalf("new runner: %v", err)
+	}
+
+	total := NewValidator("total", func(_ context.Context, _ Invocation, output []byte) ([]ValidationFailure, error) {
+		var out struct {
+			Items []int `json:"items"`
+			Total int   `json:"total"`
+		}
+		if err := json.Unmarshal(output, &out); err != nil {
+			return nil, err
+		}
+
+		sum := 0
+		for _, item := range out.Items {
+			sum += item
+		}
+
+		if sum != out.Total {
+			return []ValidationFailure{{Pointer: "/total", Message: "total must equal the sum of items"}}, nil
+		}
+
+		return nil, nil
+	})
+
+	inv := helloInvocation(t.TempDir(), map[string]any{"name": "Ada"})
+	inv.OutputSchema = `{"type":"object","properties":{"items":{"type":"array"},"total":{"type":"integer"}}}`
+
+	res, err := runner.Execute(context.Background(), inv, WithValidators(total), WithRepairAttempts(1))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if len(res.Attempts) != 2 || !strings.Contains(res.Attempts[0].Errors[0], "/total: total must equal") {
+		t.Fatalf("expected a repaired second attempt, got %+v", res.Attempts)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	RegisterBuiltinFormats()
+
+	schema := `{"type":"object","properties":{` +
+		`"version":{"type":"string","format":"semver"},"file":{"type":"string","format":"repo-path"}}}`
+
+	valid := []string{
+		`{"version":"1.2.3","file":"cmd/main.go"}`,
+		`{"version":"1.0.0-rc.1+build.5","file":"README.md"}`,
+	}
+	for _, doc := range valid {
+		if err := validateOutput(schema, []byte(doc)); err != nil {
+			t.Errorf("expected %s to be valid, got %v", doc, err)
+		}
+	}
+
+	invalid := []string{
+		`{"version":"v1.2"}`,
+		`{"version":"01.2.3"}`,
+		`{"file":"/etc/passwd"}`,
+		`{"file":"../secret"}`,
+		`{"file":"a/./b"}`,
+		`{"file":"a\\b"}`,
+	}
+	for _, doc := range invalid {
+		var validationErr *ValidationError
+		if err := validateOutput(schema, []byte(doc)); !errors.As(err, &validationErr) ||
+			validationErr.Failures[0].Keyword != "format" {
+			t.Errorf("expected format failure for %s, got %v", doc, err)
+		}
+	}
+
+	RegisterFormat("even-length", func(value string) bool { return len(value)%2 == 0 })
+
+	if _, err := StrictSchema(`{"type":"string","format":"even-length"}`); err != nil {
+		t.Fatalf("expected registered format to be known in strict mode: %v", err)
+	}
+
+	if err := validateOutput(`{"format":"even-length"}`, []byte(`"abc"`)); !errors.Is(err, ErrOutputSchemaInvalid) {
+		t.Fatalf("expected custom format failure, got %v", err)
+	}
+}